@@ -24,7 +24,7 @@ var (
 			{
 				IsDefault:        ecom.Yes,
 				Priority:         1,
-				ShippingCost:     0,
+				ShippingCost:     vipps.Ore(0),
 				ShippingMethod:   "Posten servicepakke",
 				ShippingMethodID: "123456",
 			},
@@ -40,13 +40,14 @@ var (
 func main() {
 	authClient := auth.NewClient(vipps.EnvironmentTesting, credentials)
 	ecomClient = ecom.NewClient(vipps.ClientConfig{
-		HTTPClient:  authClient,
-		Logger:      log.New(os.Stdout, "", log.LstdFlags),
-		Environment: vipps.EnvironmentTesting,
+		HTTPClient:       authClient,
+		Logger:           log.New(os.Stdout, "", log.LstdFlags),
+		Environment:      vipps.EnvironmentTesting,
+		IdempotencyStore: vipps.NewMemoryIdempotencyStore(),
 	})
 
 	mobileNumber := 97777776
-	amount := 1000
+	amount := vipps.Ore(1000)
 	orderID := "8b84-0ad5258beb0g"
 	transactionText := "A transaction"
 
@@ -59,7 +60,7 @@ func main() {
 	fmt.Printf("Captured payment: %+v\n", capturedPayment)
 }
 
-func initiatePayment(orderID, transactionText string, amount, mobileNumber int) string {
+func initiatePayment(orderID, transactionText string, amount vipps.Money, mobileNumber int) string {
 	c := ecom.InitiatePaymentCommand{
 		MerchantInfo: mi,
 		CustomerInfo: ecom.CustomerInfo{
@@ -78,9 +79,8 @@ func initiatePayment(orderID, transactionText string, amount, mobileNumber int)
 	return res.URL
 }
 
-func capturePayment(orderID, transactionText string, amount int) *ecom.CapturedPayment {
+func capturePayment(orderID, transactionText string, amount vipps.Money) *ecom.CapturedPayment {
 	p, err := ecomClient.CapturePayment(context.TODO(), ecom.CapturePaymentCommand{
-		IdempotencyKey:       "0xdeadbeef",
 		OrderID:              orderID,
 		MerchantSerialNumber: mi.MerchantSerialNumber,
 		Amount:               amount,
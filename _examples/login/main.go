@@ -2,7 +2,9 @@ package main
 
 import (
 	"context"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/torfjor/go-vipps/login"
 	"golang.org/x/sync/errgroup"
@@ -12,11 +14,25 @@ import (
 )
 
 func main() {
+	key, err := hex.DecodeString(os.Getenv("COOKIE_KEY"))
+	if err != nil {
+		fmt.Printf("COOKIE_KEY: %v", err)
+		os.Exit(1)
+	}
+	store, err := login.NewCookieStore(key)
+	if err != nil {
+		fmt.Printf("NewCookieStore: %v", err)
+		os.Exit(1)
+	}
+	// Cookies are sent over plain http to localhost only.
+	store.Insecure = true
+
 	provider, err := login.NewProvider(context.Background(), &login.ProviderConfig{
 		ClientID:     os.Getenv("CLIENT_ID"),
 		ClientSecret: os.Getenv("CLIENT_SECRET"),
 		IssuerURL:    login.IssuerURLTesting,
 		RedirectURL:  "http://localhost:3000/redirect",
+		Store:        store,
 		Scopes: []string{
 			login.ScopeName,
 			login.ScopeEmail,
@@ -32,10 +48,16 @@ func main() {
 
 	mux := http.NewServeMux()
 	mux.HandleFunc("/authorize", func(w http.ResponseWriter, r *http.Request) {
-		http.Redirect(w, r, provider.AuthCodeURL("0xdeadbeef"), http.StatusFound)
+		if err := provider.RedirectToLogin(w, r); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
 	})
 	mux.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
-		claims, err := provider.ExchangeCodeForClaims(r.Context(), r.URL.Query().Get("code"))
+		claims, err := provider.HandleRedirect(w, r)
+		if errors.Is(err, login.ErrInvalidState) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
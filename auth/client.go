@@ -7,9 +7,12 @@ package auth
 import (
 	"context"
 	"github.com/torfjor/go-vipps"
+	"github.com/torfjor/go-vipps/internal"
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/clientcredentials"
 	"net/http"
+	"strings"
+	"time"
 )
 
 const (
@@ -20,27 +23,128 @@ type customTransport struct {
 	config             clientcredentials.Config
 	apiSubscriptionKey string
 	rt                 http.RoundTripper
+	tracer             vipps.Tracer
+	metrics            *vipps.Metrics
+	headers            http.Header
+	store              TokenStore
+	earlyRefresh       time.Duration
+	baseURL            string
+}
+
+// Option configures the http.Client returned by NewClient and New.
+type Option func(*customTransport)
+
+// WithTracer makes the client trace every fetch of an access token with
+// tracer.
+func WithTracer(tracer vipps.Tracer) Option {
+	return func(ct *customTransport) {
+		ct.tracer = tracer
+	}
+}
+
+// WithMetrics makes the client count fetches of access tokens, and whether
+// they failed, with the TokenFetches counter of m.
+func WithMetrics(m *vipps.Metrics) Option {
+	return func(ct *customTransport) {
+		ct.metrics = m
+	}
+}
+
+// WithHeaders makes the client send the Vipps system headers in h with every
+// request, including fetches of access tokens, e.g. the Headers of a
+// vipps.ClientConfig. By default, headers identifying this library are sent.
+func WithHeaders(h http.Header) Option {
+	return func(ct *customTransport) {
+		ct.headers = h
+	}
+}
+
+// WithBaseURL makes the client fetch access tokens from baseURL instead of
+// from the base URL of the environment, e.g. the BaseURL of a
+// vipps.ClientConfig.
+func WithBaseURL(baseURL string) Option {
+	return func(ct *customTransport) {
+		ct.baseURL = strings.TrimSuffix(baseURL, "/")
+	}
+}
+
+// WithTransport makes the client send requests, including fetches of access
+// tokens, with rt, e.g. to set timeouts, a proxy or TLS settings. It defaults
+// to a clone of http.DefaultTransport.
+func WithTransport(rt http.RoundTripper) Option {
+	return func(ct *customTransport) {
+		if rt != nil {
+			ct.rt = rt
+		}
+	}
 }
 
 // NewClient returns a http.Client with a custom Transport that adds required
 // headers for authorizing Vipps API clients. JWT tokens are automatically
-// fetched and renewed upon expiry.
-func NewClient(environment vipps.Environment, credentials vipps.Credentials) *http.Client {
-	var baseUrl string
-	if environment == vipps.EnvironmentTesting {
-		baseUrl = vipps.BaseURLTesting
-	} else {
-		baseUrl = vipps.BaseURL
+// fetched and renewed shortly before expiry, and kept in a TokenStore.
+//
+// It panics if environment is unknown and no base URL is given with
+// WithBaseURL. Use New to get an error instead.
+func NewClient(environment vipps.Environment, credentials vipps.Credentials, opts ...Option) *http.Client {
+	c, err := newClient(environment, credentials, opts)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// New is like NewClient, but returns an error if credentials are incomplete or
+// environment is unknown and no base URL is given with WithBaseURL.
+func New(environment vipps.Environment, credentials vipps.Credentials, opts ...Option) (*http.Client, error) {
+	if err := credentials.Validate(); err != nil {
+		return nil, err
+	}
+	return newClient(environment, credentials, opts)
+}
+
+// NewFromConfig returns a client authenticating with the Credentials of
+// config, and fetching access tokens from its Environment or BaseURL with its
+// Transport, headers, Tracer and Metrics. opts are applied last.
+func NewFromConfig(config vipps.ClientConfig, opts ...Option) (*http.Client, error) {
+	return New(config.Environment, config.Credentials, append(configOptions(config), opts...)...)
+}
+
+// configOptions returns the Options that make a client fetch access tokens
+// like the Client built from config sends requests.
+func configOptions(config vipps.ClientConfig) []Option {
+	return []Option{
+		WithBaseURL(config.BaseURL),
+		WithHeaders(config.Headers()),
+		WithTracer(config.Tracer),
+		WithMetrics(config.Metrics),
+		WithTransport(config.Transport),
 	}
+}
 
+func newClient(environment vipps.Environment, credentials vipps.Credentials, opts []Option) (*http.Client, error) {
 	tr := &customTransport{
 		config: clientcredentials.Config{
 			ClientID:     credentials.ClientID,
 			ClientSecret: credentials.ClientSecret,
-			TokenURL:     baseUrl + tokenEndpoint,
 		},
 		apiSubscriptionKey: credentials.APISubscriptionKey,
-		rt:                 &http.Transport{},
+		rt:                 http.DefaultTransport.(*http.Transport).Clone(),
+		headers:            vipps.ClientConfig{}.Headers(),
+		earlyRefresh:       DefaultEarlyRefresh,
+	}
+	for _, opt := range opts {
+		opt(tr)
+	}
+	baseUrl := tr.baseURL
+	if baseUrl == "" {
+		var err error
+		if baseUrl, err = environment.BaseURL(); err != nil {
+			return nil, err
+		}
+	}
+	tr.config.TokenURL = baseUrl + tokenEndpoint
+	if tr.store == nil {
+		tr.store = NewMemoryStore()
 	}
 
 	tokenClient := &http.Client{
@@ -48,16 +152,37 @@ func NewClient(environment vipps.Environment, credentials vipps.Credentials) *ht
 	}
 
 	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, tokenClient)
-	return tr.config.Client(ctx)
+	return &http.Client{
+		Transport: &oauth2.Transport{
+			Source: &storeTokenSource{
+				fetch: func() (*oauth2.Token, error) { return tr.config.Token(ctx) },
+				store: tr.store,
+				key:   tr.config.ClientID + "@" + tr.config.TokenURL,
+				early: tr.earlyRefresh,
+			},
+			Base: tr,
+		},
+	}, nil
 }
 
 // RoundTrip satisfies interface http.RoundTripper
 func (ct *customTransport) RoundTrip(request *http.Request) (*http.Response, error) {
-	if request.URL.Path == tokenEndpoint {
+	if strings.HasSuffix(request.URL.Path, tokenEndpoint) {
 		request.Header.Add("client_id", ct.config.ClientID)
 		request.Header.Add("client_secret", ct.config.ClientSecret)
 	}
 	request.Header.Add("Ocp-Apim-Subscription-Key", ct.apiSubscriptionKey)
+	internal.SetDefaultHeaders(request, ct.headers)
 
-	return ct.rt.RoundTrip(request)
+	if !strings.HasSuffix(request.URL.Path, tokenEndpoint) {
+		return ct.rt.RoundTrip(request)
+	}
+	ctx, span := vipps.StartSpan(request.Context(), ct.tracer, vipps.SpanKindClient, "auth.FetchToken")
+	resp, err := ct.rt.RoundTrip(request.WithContext(ctx))
+	if err == nil {
+		span.SetAttributes(vipps.Attribute{Key: vipps.AttributeHTTPStatus, Value: resp.StatusCode})
+	}
+	vipps.EndSpan(span, err)
+	ct.metrics.CountTokenFetch(resp, err)
+	return resp, err
 }
@@ -0,0 +1,166 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"github.com/torfjor/go-vipps"
+	"net/http"
+	"sync"
+)
+
+// ErrUnknownMerchant is returned for requests on behalf of a merchant that is
+// not registered with a Registry.
+var ErrUnknownMerchant = errors.New("auth: unknown merchant")
+
+// Merchant is a sales unit that a Registry authenticates requests for.
+type Merchant struct {
+	// SerialNumber is the Merchant-Serial-Number (MSN) of the sales unit.
+	SerialNumber string
+	// Credentials, if set, are the sales unit's own. Otherwise requests are
+	// authenticated with the partner credentials of the Registry.
+	Credentials vipps.Credentials
+}
+
+// Registry authenticates requests on behalf of many merchants, identified by
+// the `Merchant-Serial-Number` header of each request. Merchants without
+// credentials of their own are served with partner keys: the partner
+// credentials authenticate the request, and the header tells Vipps which
+// merchant it is for.
+//
+// Access tokens are fetched and cached per set of credentials, in a TokenStore
+// shared by all merchants:
+//
+//	config := vipps.ClientConfig{Environment: vipps.EnvironmentTesting, Credentials: partnerCredentials}
+//	reg, err := auth.NewRegistryFromConfig(config)
+//	if err != nil {
+//		return err
+//	}
+//	for _, m := range []auth.Merchant{
+//		{SerialNumber: "123456"},
+//		{SerialNumber: "654321", Credentials: ownCredentials},
+//	} {
+//		if err := reg.Register(m); err != nil {
+//			return err
+//		}
+//	}
+//
+//	config.HTTPClient = reg.Client()
+//	client := ecom.NewClient(config)
+//	_, err = client.CapturePayment(vipps.ContextWithMerchant(ctx, "654321"), cmd)
+type Registry struct {
+	environment vipps.Environment
+	partner     vipps.Credentials
+	opts        []Option
+
+	mu        sync.Mutex
+	merchants map[string]Merchant
+	clients   map[vipps.Credentials]*http.Client
+}
+
+// NewRegistry returns a Registry authenticating merchants in environment,
+// with partner as the partner credentials, if set. opts apply to the clients
+// of every merchant; the merchants share a MemoryStore unless another
+// TokenStore is given. Access tokens are fetched from environment unless a
+// base URL is given with WithBaseURL, even if the API clients use another
+// BaseURL; use NewRegistryFromConfig to take it from their config.
+func NewRegistry(environment vipps.Environment, partner vipps.Credentials, opts ...Option) (*Registry, error) {
+	if partner != (vipps.Credentials{}) {
+		if err := partner.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	// Fail early on an unknown environment.
+	if _, err := newClient(environment, partner, opts); err != nil {
+		return nil, err
+	}
+	return &Registry{
+		environment: environment,
+		partner:     partner,
+		opts:        append([]Option{WithTokenStore(NewMemoryStore())}, opts...),
+		merchants:   make(map[string]Merchant),
+		clients:     make(map[vipps.Credentials]*http.Client),
+	}, nil
+}
+
+// NewRegistryFromConfig is like NewRegistry, with the Credentials of config,
+// if any, as the partner credentials, and fetching access tokens from its
+// Environment or BaseURL with its Transport, headers, Tracer and Metrics.
+// opts are applied last.
+func NewRegistryFromConfig(config vipps.ClientConfig, opts ...Option) (*Registry, error) {
+	return NewRegistry(config.Environment, config.Credentials, append(configOptions(config), opts...)...)
+}
+
+// Register adds m to the registry, replacing any merchant with the same
+// SerialNumber. It fails if m has no credentials of its own and the registry
+// has no partner credentials.
+func (r *Registry) Register(m Merchant) error {
+	if m.SerialNumber == "" {
+		return fmt.Errorf("%w: missing SerialNumber", vipps.ErrInvalidConfig)
+	}
+	if m.Credentials == (vipps.Credentials{}) {
+		if r.partner == (vipps.Credentials{}) {
+			return fmt.Errorf("%w: merchant %s has no credentials, and there are no partner credentials", vipps.ErrInvalidConfig, m.SerialNumber)
+		}
+	} else if err := m.Credentials.Validate(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.merchants[m.SerialNumber] = m
+	return nil
+}
+
+// Merchant returns the merchant registered with msn, if any.
+func (r *Registry) Merchant(msn string) (Merchant, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	m, ok := r.merchants[msn]
+	return m, ok
+}
+
+// Client returns a http.Client that authenticates every request for the
+// merchant in its `Merchant-Serial-Number` header, e.g. for the HTTPClient
+// of a vipps.ClientConfig.
+func (r *Registry) Client() *http.Client {
+	return &http.Client{Transport: r}
+}
+
+// RoundTrip satisfies interface http.RoundTripper
+func (r *Registry) RoundTrip(req *http.Request) (*http.Response, error) {
+	client, err := r.client(req.Header.Get(vipps.HeaderMerchantSerialNumber))
+	if err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+	return client.Transport.RoundTrip(req)
+}
+
+// client returns the client for the credentials of the merchant with msn,
+// creating it on first use.
+func (r *Registry) client(msn string) (*http.Client, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	m, ok := r.merchants[msn]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownMerchant, msn)
+	}
+	credentials := m.Credentials
+	if credentials == (vipps.Credentials{}) {
+		credentials = r.partner
+	}
+	if c, ok := r.clients[credentials]; ok {
+		return c, nil
+	}
+	c, err := newClient(r.environment, credentials, r.opts)
+	if err != nil {
+		return nil, err
+	}
+	r.clients[credentials] = c
+	return c, nil
+}
@@ -0,0 +1,201 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"github.com/torfjor/go-vipps"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+var (
+	partner = vipps.Credentials{ClientID: "partner", ClientSecret: "secret", APISubscriptionKey: "partner-key"}
+	own     = vipps.Credentials{ClientID: "own", ClientSecret: "secret", APISubscriptionKey: "own-key"}
+)
+
+// tokenServer issues an access token per client id, counts the fetches, and
+// replies to other requests with the access token and subscription key that
+// they were sent with.
+type tokenServer struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	fetches map[string]int
+}
+
+func newTokenServer(t *testing.T) *tokenServer {
+	t.Helper()
+	s := &tokenServer{fetches: make(map[string]int)}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == tokenEndpoint {
+			id := r.Header.Get("client_id")
+			s.mu.Lock()
+			s.fetches[id]++
+			s.mu.Unlock()
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(w, `{"access_token":"token-%s","token_type":"Bearer","expires_in":3600}`, id)
+			return
+		}
+		fmt.Fprintf(w, "%s %s", r.Header.Get("Authorization"), r.Header.Get("Ocp-Apim-Subscription-Key"))
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *tokenServer) Fetches(clientID string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.fetches[clientID]
+}
+
+func newTestRegistry(t *testing.T, srv *tokenServer) *Registry {
+	t.Helper()
+	reg, err := NewRegistryFromConfig(vipps.ClientConfig{BaseURL: srv.URL, Credentials: partner})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range []Merchant{
+		{SerialNumber: "123456"},
+		{SerialNumber: "234567"},
+		{SerialNumber: "654321", Credentials: own},
+	} {
+		if err := reg.Register(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return reg
+}
+
+// get sends a request for the merchant with msn with client, and returns the
+// reply.
+func get(client *http.Client, url, msn string) (string, error) {
+	req, err := http.NewRequest(http.MethodGet, url+"/ecomm/v2/payments", nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set(vipps.HeaderMerchantSerialNumber, msn)
+	res, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	b, err := ioutil.ReadAll(res.Body)
+	return string(b), err
+}
+
+func TestRegistry(t *testing.T) {
+	srv := newTokenServer(t)
+	client := newTestRegistry(t, srv).Client()
+	tests := []struct {
+		name    string
+		msn     string
+		want    string
+		wantErr error
+	}{
+		{"partner keys", "123456", "Bearer token-partner partner-key", nil},
+		{"own credentials", "654321", "Bearer token-own own-key", nil},
+		{"unknown merchant", "999999", "", ErrUnknownMerchant},
+		{"no merchant", "", "", ErrUnknownMerchant},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := get(client, srv.URL, tt.msn)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("request = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("authenticated with %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegistryRegister(t *testing.T) {
+	srv := newTokenServer(t)
+	withPartner := newTestRegistry(t, srv)
+	withoutPartner, err := NewRegistryFromConfig(vipps.ClientConfig{BaseURL: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		reg     *Registry
+		m       Merchant
+		wantErr bool
+	}{
+		{"partner keys", withPartner, Merchant{SerialNumber: "345678"}, false},
+		{"own credentials", withoutPartner, Merchant{SerialNumber: "345678", Credentials: own}, false},
+		{"no serial number", withPartner, Merchant{Credentials: own}, true},
+		{"no partner", withoutPartner, Merchant{SerialNumber: "456789"}, true},
+		{"incomplete credentials", withPartner, Merchant{SerialNumber: "567890", Credentials: vipps.Credentials{ClientID: "own"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.reg.Register(tt.m); (err != nil) != tt.wantErr {
+				t.Fatalf("Register = %v, want error %v", err, tt.wantErr)
+			}
+			if _, ok := tt.reg.Merchant(tt.m.SerialNumber); ok == tt.wantErr {
+				t.Errorf("Merchant registered = %v, want %v", ok, !tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRegistryClientCaching(t *testing.T) {
+	srv := newTokenServer(t)
+	reg := newTestRegistry(t, srv)
+	client := reg.Client()
+
+	for i := 0; i < 3; i++ {
+		for _, msn := range []string{"123456", "234567", "654321"} {
+			if _, err := get(client, srv.URL, msn); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	for _, id := range []string{partner.ClientID, own.ClientID} {
+		if n := srv.Fetches(id); n != 1 {
+			t.Errorf("token fetches for %s = %d, want 1", id, n)
+		}
+	}
+	if n := len(reg.clients); n != 2 {
+		t.Errorf("clients = %d, want one per set of credentials", n)
+	}
+}
+
+// body is a request body that records whether it is closed.
+type body struct {
+	io.Reader
+	closed bool
+}
+
+func (b *body) Close() error {
+	b.closed = true
+	return nil
+}
+
+func TestRegistryUnknownMerchantClosesBody(t *testing.T) {
+	srv := newTokenServer(t)
+	reg := newTestRegistry(t, srv)
+
+	b := &body{Reader: strings.NewReader("{}")}
+	req, err := http.NewRequest(http.MethodPost, srv.URL+"/ecomm/v2/payments", b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set(vipps.HeaderMerchantSerialNumber, "999999")
+	if _, err := reg.RoundTrip(req); !errors.Is(err, ErrUnknownMerchant) {
+		t.Errorf("RoundTrip = %v, want %v", err, ErrUnknownMerchant)
+	}
+	if !b.closed {
+		t.Error("request body not closed")
+	}
+	if n := srv.Fetches(partner.ClientID); n != 0 {
+		t.Errorf("token fetches = %d, want none", n)
+	}
+}
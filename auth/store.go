@@ -0,0 +1,183 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"golang.org/x/oauth2"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// DefaultEarlyRefresh is how long before its expiry an access token is
+// refreshed by default.
+const DefaultEarlyRefresh = time.Minute
+
+// TokenStore stores access tokens, so that they can be shared between
+// clients, processes and hosts, and every one of them does not have to fetch
+// its own. A distributed backend, e.g. Redis, can be plugged in by
+// implementing it:
+//
+//	func (s redisStore) Token(ctx context.Context, key string) (*oauth2.Token, error) {
+//		b, err := s.client.Get(ctx, key).Bytes()
+//		if err == redis.Nil {
+//			return nil, nil
+//		}
+//		...
+//	}
+//
+// Keys identify the client and the token endpoint, and are safe to use as is.
+type TokenStore interface {
+	// Token returns the token stored for key, or nil if there is none.
+	Token(ctx context.Context, key string) (*oauth2.Token, error)
+	// SetToken stores token for key.
+	SetToken(ctx context.Context, key string, token *oauth2.Token) error
+}
+
+// WithTokenStore makes the client keep access tokens in store, instead of in
+// a store of its own.
+func WithTokenStore(store TokenStore) Option {
+	return func(ct *customTransport) {
+		ct.store = store
+	}
+}
+
+// WithEarlyRefresh makes the client refresh access tokens d before they
+// expire, instead of DefaultEarlyRefresh.
+func WithEarlyRefresh(d time.Duration) Option {
+	return func(ct *customTransport) {
+		ct.earlyRefresh = d
+	}
+}
+
+// MemoryStore is a TokenStore that keeps tokens in memory. It can be shared by
+// clients in the same process.
+type MemoryStore struct {
+	mu     sync.Mutex
+	tokens map[string]*oauth2.Token
+}
+
+// NewMemoryStore returns a new MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{tokens: make(map[string]*oauth2.Token)}
+}
+
+// Token satisfies TokenStore.
+func (s *MemoryStore) Token(ctx context.Context, key string) (*oauth2.Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.tokens[key], nil
+}
+
+// SetToken satisfies TokenStore.
+func (s *MemoryStore) SetToken(ctx context.Context, key string, token *oauth2.Token) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tokens[key] = token
+	return nil
+}
+
+// FileStore is a TokenStore that keeps tokens in files in a directory, e.g. a
+// volume shared by processes on a host. Files are written atomically and are
+// only readable by their owner.
+type FileStore struct {
+	Dir string
+}
+
+// NewFileStore returns a FileStore keeping tokens in dir. The directory is
+// created if it does not exist.
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &FileStore{Dir: dir}, nil
+}
+
+// Token satisfies TokenStore.
+func (s *FileStore) Token(ctx context.Context, key string) (*oauth2.Token, error) {
+	b, err := ioutil.ReadFile(s.path(key))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var token oauth2.Token
+	if err := json.Unmarshal(b, &token); err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// SetToken satisfies TokenStore.
+func (s *FileStore) SetToken(ctx context.Context, key string, token *oauth2.Token) error {
+	b, err := json.Marshal(token)
+	if err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(s.Dir, ".token-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), s.path(key))
+}
+
+func (s *FileStore) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(s.Dir, hex.EncodeToString(sum[:])+".json")
+}
+
+// storeTokenSource is an oauth2.TokenSource that fetches tokens with fetch
+// only when the token in store is about to expire. Concurrent calls wait for
+// a single fetch.
+type storeTokenSource struct {
+	mu    sync.Mutex
+	fetch func() (*oauth2.Token, error)
+	store TokenStore
+	key   string
+	early time.Duration
+}
+
+// Token satisfies oauth2.TokenSource.
+func (s *storeTokenSource) Token() (*oauth2.Token, error) {
+	ctx := context.Background()
+	if token, err := s.store.Token(ctx, s.key); err == nil && s.fresh(token) {
+		return token, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Another call may have fetched a token while this one waited.
+	if token, err := s.store.Token(ctx, s.key); err == nil && s.fresh(token) {
+		return token, nil
+	}
+	token, err := s.fetch()
+	if err != nil {
+		return nil, err
+	}
+	// The store is a cache: the token is good even if it could not be stored.
+	_ = s.store.SetToken(ctx, s.key, token)
+	return token, nil
+}
+
+func (s *storeTokenSource) fresh(token *oauth2.Token) bool {
+	if token == nil || token.AccessToken == "" {
+		return false
+	}
+	return token.Expiry.IsZero() || time.Now().Add(s.early).Before(token.Expiry)
+}
@@ -0,0 +1,151 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"golang.org/x/oauth2"
+	"io/ioutil"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestStoreTokenSourceSingleFlight(t *testing.T) {
+	var (
+		fetches int32
+		release = make(chan struct{})
+	)
+	s := &storeTokenSource{
+		fetch: func() (*oauth2.Token, error) {
+			atomic.AddInt32(&fetches, 1)
+			<-release
+			return &oauth2.Token{AccessToken: "token", Expiry: time.Now().Add(time.Hour)}, nil
+		},
+		store: NewMemoryStore(),
+		key:   "key",
+		early: DefaultEarlyRefresh,
+	}
+
+	const calls = 20
+	var wg sync.WaitGroup
+	errs := make(chan error, calls)
+	for i := 0; i < calls; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			token, err := s.Token()
+			if err == nil && token.AccessToken != "token" {
+				err = errors.New("unexpected token " + token.AccessToken)
+			}
+			errs <- err
+		}()
+	}
+	// Let the calls pile up behind the first fetch.
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	if n := atomic.LoadInt32(&fetches); n != 1 {
+		t.Errorf("fetches = %d, want 1", n)
+	}
+}
+
+func TestStoreTokenSourceRefresh(t *testing.T) {
+	tests := []struct {
+		name      string
+		stored    *oauth2.Token
+		early     time.Duration
+		wantFetch bool
+	}{
+		{"empty store", nil, time.Minute, true},
+		{"fresh", &oauth2.Token{AccessToken: "stored", Expiry: time.Now().Add(time.Hour)}, time.Minute, false},
+		{"no expiry", &oauth2.Token{AccessToken: "stored"}, time.Minute, false},
+		{"about to expire", &oauth2.Token{AccessToken: "stored", Expiry: time.Now().Add(30 * time.Second)}, time.Minute, true},
+		{"expired", &oauth2.Token{AccessToken: "stored", Expiry: time.Now().Add(-time.Second)}, 0, true},
+		{"no access token", &oauth2.Token{Expiry: time.Now().Add(time.Hour)}, time.Minute, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewMemoryStore()
+			if tt.stored != nil {
+				store.SetToken(context.Background(), "key", tt.stored)
+			}
+			fetched := &oauth2.Token{AccessToken: "fetched", Expiry: time.Now().Add(time.Hour)}
+			s := &storeTokenSource{
+				fetch: func() (*oauth2.Token, error) { return fetched, nil },
+				store: store,
+				key:   "key",
+				early: tt.early,
+			}
+			token, err := s.Token()
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := "stored"
+			if tt.wantFetch {
+				want = "fetched"
+			}
+			if token.AccessToken != want {
+				t.Errorf("AccessToken = %q, want %q", token.AccessToken, want)
+			}
+			if stored, _ := store.Token(context.Background(), "key"); stored.AccessToken != want {
+				t.Errorf("stored AccessToken = %q, want %q", stored.AccessToken, want)
+			}
+		})
+	}
+}
+
+func TestStoreTokenSourceFetchError(t *testing.T) {
+	wantErr := errors.New("fetch failed")
+	store := NewMemoryStore()
+	s := &storeTokenSource{
+		fetch: func() (*oauth2.Token, error) { return nil, wantErr },
+		store: store,
+		key:   "key",
+	}
+	if _, err := s.Token(); err != wantErr {
+		t.Errorf("Token = %v, want %v", err, wantErr)
+	}
+	if stored, _ := store.Token(context.Background(), "key"); stored != nil {
+		t.Errorf("stored %v, want nothing", stored)
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tokens")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if token, err := store.Token(ctx, "key"); token != nil || err != nil {
+		t.Fatalf("Token = %v, %v, want nil, nil", token, err)
+	}
+	want := &oauth2.Token{AccessToken: "token", TokenType: "Bearer", Expiry: time.Now().Add(time.Hour).Round(time.Second)}
+	if err := store.SetToken(ctx, "key", want); err != nil {
+		t.Fatal(err)
+	}
+	got, err := store.Token(ctx, "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.AccessToken != want.AccessToken || got.TokenType != want.TokenType || !got.Expiry.Equal(want.Expiry) {
+		t.Errorf("Token = %+v, want %+v", got, want)
+	}
+	if token, _ := store.Token(ctx, "other"); token != nil {
+		t.Errorf("Token(other) = %v, want nil", token)
+	}
+}
@@ -0,0 +1,80 @@
+package ecom
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+)
+
+// Authenticator authorizes callback requests from Vipps, typically by their
+// `Authorization` header. orderID is the order the callback is about, or
+// empty for callbacks that are not about an order.
+type Authenticator interface {
+	Authenticate(r *http.Request, orderID string) bool
+}
+
+// AuthenticatorFunc is an adapter to allow the use of ordinary functions as
+// Authenticators.
+type AuthenticatorFunc func(r *http.Request, orderID string) bool
+
+// Authenticate calls f(r, orderID).
+func (f AuthenticatorFunc) Authenticate(r *http.Request, orderID string) bool {
+	return f(r, orderID)
+}
+
+// StaticTokens returns an Authenticator that accepts requests whose
+// `Authorization` header equals one of tokens. Several tokens can be active
+// at once, so that MerchantInfo.AuthToken can be rotated without rejecting
+// callbacks for payments initiated with the old token. Empty tokens are
+// ignored, so that a missing `Authorization` header never matches, and
+// StaticTokens("") rejects every request.
+//
+// Tokens are compared in constant time.
+func StaticTokens(tokens ...string) Authenticator {
+	return AuthenticatorFunc(func(r *http.Request, orderID string) bool {
+		return matchAny(r.Header.Get("Authorization"), tokens)
+	})
+}
+
+// OrderTokens returns an Authenticator that accepts requests whose
+// `Authorization` header is the token derived with DeriveToken from the order
+// id and one of secrets. Several secrets can be active at once, to rotate
+// them. Requests that are not about an order are rejected.
+//
+// Tokens are compared in constant time.
+func OrderTokens(secrets ...[]byte) Authenticator {
+	return AuthenticatorFunc(func(r *http.Request, orderID string) bool {
+		if orderID == "" {
+			return false
+		}
+		tokens := make([]string, len(secrets))
+		for i, secret := range secrets {
+			tokens[i] = DeriveToken(secret, orderID)
+		}
+		return matchAny(r.Header.Get("Authorization"), tokens)
+	})
+}
+
+// DeriveToken returns a token for orderID, derived from secret with
+// HMAC-SHA256. Use it as MerchantInfo.AuthToken when initiating the payment,
+// and authenticate its callbacks with OrderTokens.
+func DeriveToken(secret []byte, orderID string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(orderID))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// matchAny reports whether got equals any of tokens, without leaking which
+// one or how much of it matched through timing. Empty tokens never match.
+func matchAny(got string, tokens []string) bool {
+	if got == "" {
+		return false
+	}
+	match := 0
+	for _, token := range tokens {
+		match |= subtle.ConstantTimeCompare([]byte(got), []byte(token))
+	}
+	return match == 1
+}
@@ -0,0 +1,62 @@
+package ecom
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestStaticTokens(t *testing.T) {
+	tests := []struct {
+		name   string
+		tokens []string
+		header string
+		want   bool
+	}{
+		{"match", []string{"token"}, "token", true},
+		{"rotated", []string{"new", "old"}, "old", true},
+		{"mismatch", []string{"token"}, "other", false},
+		{"missing header", []string{"token"}, "", false},
+		{"empty token, missing header", []string{""}, "", false},
+		{"empty token among others", []string{"", "token"}, "", false},
+		{"no tokens", nil, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/v2/payments/order-1", nil)
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+			if got := StaticTokens(tt.tokens...).Authenticate(r, "order-1"); got != tt.want {
+				t.Errorf("Authenticate = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOrderTokens(t *testing.T) {
+	secret := []byte("secret")
+	tests := []struct {
+		name    string
+		orderID string
+		header  string
+		want    bool
+	}{
+		{"derived", "order-1", DeriveToken(secret, "order-1"), true},
+		{"other order", "order-2", DeriveToken(secret, "order-1"), false},
+		{"other secret", "order-1", DeriveToken([]byte("other"), "order-1"), false},
+		{"no order", "", DeriveToken(secret, ""), false},
+		{"missing header", "order-1", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/v2/payments/"+tt.orderID, nil)
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+			if got := OrderTokens(secret).Authenticate(r, tt.orderID); got != tt.want {
+				t.Errorf("Authenticate = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"github.com/go-kit/kit/log"
 	"github.com/torfjor/go-vipps"
+	"github.com/torfjor/go-vipps/auth"
 	"github.com/torfjor/go-vipps/internal"
 	"net/http"
 	"net/url"
@@ -19,21 +20,55 @@ type Doer interface {
 type Client struct {
 	BaseURL   string
 	APIClient Doer
+	// SkipValidation disables the validation of commands before they are
+	// sent.
+	SkipValidation bool
+	// Tracer, if set, traces every call on the Client.
+	Tracer vipps.Tracer
+	// MerchantSerialNumber is used for commands that have none, unless the
+	// context of the call carries one, see vipps.ContextWithMerchant.
+	MerchantSerialNumber string
+	// IdempotencyStore, if set, remembers the idempotency keys generated for
+	// commands that have none.
+	IdempotencyStore vipps.IdempotencyStore
 }
 
-// NewClient returns a configured Client
+// NewClient returns a configured Client. It panics if config has no
+// HTTPClient, or an unknown Environment and no BaseURL. An empty Environment
+// means production. Use New to get an error instead.
 func NewClient(config vipps.ClientConfig) *Client {
-	var baseUrl string
-	var logger log.Logger
-
 	if config.HTTPClient == nil {
 		panic("config.HTTPClient cannot be nil")
 	}
+	c, err := newClient(config)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
 
-	if config.Environment == vipps.EnvironmentTesting {
-		baseUrl = vipps.BaseURLTesting
-	} else {
-		baseUrl = vipps.BaseURL
+// New returns a Client configured with opts, or an error if the configuration
+// is invalid. Unless it is given a HTTPClient, the Client authenticates with
+// the Credentials, see auth.NewFromConfig.
+func New(opts ...vipps.Option) (*Client, error) {
+	config, err := vipps.NewConfig(opts...)
+	if err != nil {
+		return nil, err
+	}
+	if config.HTTPClient == nil {
+		if config.HTTPClient, err = auth.NewFromConfig(config); err != nil {
+			return nil, err
+		}
+	}
+	return newClient(config)
+}
+
+func newClient(config vipps.ClientConfig) (*Client, error) {
+	var logger log.Logger
+
+	baseUrl, err := config.APIBaseURL()
+	if err != nil {
+		return nil, err
 	}
 
 	if config.Logger == nil {
@@ -46,14 +81,27 @@ func NewClient(config vipps.ClientConfig) *Client {
 		BaseURL: baseUrl,
 		APIClient: &internal.APIClient{
 			L: logger,
-			C: config.HTTPClient,
+			C: config.Doer(),
+			R: (*internal.RetryPolicy)(config.RetryPolicy),
+			H: config.Headers(),
 		},
-	}
+		SkipValidation:       config.SkipValidation,
+		Tracer:               config.Tracer,
+		MerchantSerialNumber: config.MerchantSerialNumber,
+		IdempotencyStore:     config.IdempotencyStore,
+	}, nil
 }
 
 // CancelPayment cancels an initiated payment. Errors for payments that are not
 // in a cancellable state.
-func (c *Client) CancelPayment(ctx context.Context, cmd CancelPaymentCommand) (*CancelledPayment, error) {
+func (c *Client) CancelPayment(ctx context.Context, cmd CancelPaymentCommand) (_ *CancelledPayment, err error) {
+	ctx, span := vipps.StartSpan(ctx, c.Tracer, vipps.SpanKindClient, "ecom.CancelPayment", vipps.OrderIDAttr(cmd.OrderID))
+	defer func() { vipps.EndSpan(span, err) }()
+
+	cmd.MerchantSerialNumber = c.merchant(ctx, cmd.MerchantSerialNumber)
+	if err := c.validate(cmd); err != nil {
+		return nil, err
+	}
 	endpoint := fmt.Sprintf("%s/%s/%s/cancel", c.BaseURL, ecomEndpoint, cmd.OrderID)
 	method := http.MethodPut
 	res := CancelledPayment{}
@@ -72,6 +120,7 @@ func (c *Client) CancelPayment(ctx context.Context, cmd CancelPaymentCommand) (*
 	if err != nil {
 		return nil, err
 	}
+	internal.SetMerchant(req, cmd.MerchantSerialNumber)
 
 	err = c.APIClient.Do(req, &res)
 	if err != nil {
@@ -82,7 +131,19 @@ func (c *Client) CancelPayment(ctx context.Context, cmd CancelPaymentCommand) (*
 }
 
 // CapturePayment captures reserved amounts on a Payment
-func (c *Client) CapturePayment(ctx context.Context, cmd CapturePaymentCommand) (*CapturedPayment, error) {
+func (c *Client) CapturePayment(ctx context.Context, cmd CapturePaymentCommand) (_ *CapturedPayment, err error) {
+	ctx, span := vipps.StartSpan(ctx, c.Tracer, vipps.SpanKindClient, "ecom.CapturePayment", vipps.OrderIDAttr(cmd.OrderID))
+	defer func() { vipps.EndSpan(span, err) }()
+
+	cmd.MerchantSerialNumber = c.merchant(ctx, cmd.MerchantSerialNumber)
+	if err := c.validate(cmd); err != nil {
+		return nil, err
+	}
+	key, done, err := internal.IdempotencyKey(ctx, internal.Logger(c.APIClient), c.IdempotencyStore,
+		fmt.Sprintf("ecom.CapturePayment/%s/%s/%d", cmd.MerchantSerialNumber, cmd.OrderID, cmd.Amount.Minor), cmd.IdempotencyKey)
+	if err != nil {
+		return nil, err
+	}
 	endpoint := fmt.Sprintf("%s/%s/%s/capture", c.BaseURL, ecomEndpoint, cmd.OrderID)
 	method := http.MethodPost
 	res := CapturedPayment{}
@@ -91,8 +152,8 @@ func (c *Client) CapturePayment(ctx context.Context, cmd CapturePaymentCommand)
 			MerchantSerialNumber string `json:"merchantSerialNumber"`
 		} `json:"merchantInfo"`
 		Transaction struct {
-			Amount          int    `json:"amount"`
-			TransactionText string `json:"transactionText"`
+			Amount          vipps.Money `json:"amount"`
+			TransactionText string      `json:"transactionText"`
 		} `json:"transaction"`
 	}{}
 	command.MerchantInfo.MerchantSerialNumber = cmd.MerchantSerialNumber
@@ -103,17 +164,23 @@ func (c *Client) CapturePayment(ctx context.Context, cmd CapturePaymentCommand)
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Add("X-Request-ID", cmd.IdempotencyKey)
+	internal.SetMerchant(req, cmd.MerchantSerialNumber)
+	req.Header.Add("X-Request-ID", key)
 	err = c.APIClient.Do(req, &res)
+	done(err)
 	if err != nil {
 		return nil, wrapErr(err)
 	}
+	res.IdempotencyKey = key
 
 	return &res, nil
 }
 
 // GetPayment gets a Payment.
-func (c *Client) GetPayment(ctx context.Context, orderID string) (*Payment, error) {
+func (c *Client) GetPayment(ctx context.Context, orderID string) (_ *Payment, err error) {
+	ctx, span := vipps.StartSpan(ctx, c.Tracer, vipps.SpanKindClient, "ecom.GetPayment", vipps.OrderIDAttr(orderID))
+	defer func() { vipps.EndSpan(span, err) }()
+
 	endpoint := fmt.Sprintf("%s/%s/%s/details", c.BaseURL, ecomEndpoint, orderID)
 	method := http.MethodGet
 	res := Payment{}
@@ -122,6 +189,7 @@ func (c *Client) GetPayment(ctx context.Context, orderID string) (*Payment, erro
 	if err != nil {
 		return nil, err
 	}
+	internal.SetMerchant(req, c.merchant(ctx, ""))
 
 	err = c.APIClient.Do(req, &res)
 	if err != nil {
@@ -133,7 +201,14 @@ func (c *Client) GetPayment(ctx context.Context, orderID string) (*Payment, erro
 
 // InitiatePayment initiates a new Payment and returns a reference to a resource
 // hosted by Vipps where the payment flow can continue.
-func (c *Client) InitiatePayment(ctx context.Context, cmd InitiatePaymentCommand) (*PaymentReference, error) {
+func (c *Client) InitiatePayment(ctx context.Context, cmd InitiatePaymentCommand) (_ *PaymentReference, err error) {
+	ctx, span := vipps.StartSpan(ctx, c.Tracer, vipps.SpanKindClient, "ecom.InitiatePayment", vipps.OrderIDAttr(cmd.Transaction.OrderID))
+	defer func() { vipps.EndSpan(span, err) }()
+
+	cmd.MerchantInfo.MerchantSerialNumber = c.merchant(ctx, cmd.MerchantInfo.MerchantSerialNumber)
+	if err := c.validate(cmd); err != nil {
+		return nil, err
+	}
 	q := url.Values{
 		"scopes": []string{"name"},
 	}
@@ -145,6 +220,7 @@ func (c *Client) InitiatePayment(ctx context.Context, cmd InitiatePaymentCommand
 	if err != nil {
 		return nil, err
 	}
+	internal.SetMerchant(req, cmd.MerchantInfo.MerchantSerialNumber)
 
 	err = c.APIClient.Do(req, &res)
 	if err != nil {
@@ -155,7 +231,19 @@ func (c *Client) InitiatePayment(ctx context.Context, cmd InitiatePaymentCommand
 }
 
 // RefundPayment refunds already captured amounts on a Payment.
-func (c *Client) RefundPayment(ctx context.Context, cmd RefundPaymentCommand) (*RefundedPayment, error) {
+func (c *Client) RefundPayment(ctx context.Context, cmd RefundPaymentCommand) (_ *RefundedPayment, err error) {
+	ctx, span := vipps.StartSpan(ctx, c.Tracer, vipps.SpanKindClient, "ecom.RefundPayment", vipps.OrderIDAttr(cmd.OrderID))
+	defer func() { vipps.EndSpan(span, err) }()
+
+	cmd.MerchantSerialNumber = c.merchant(ctx, cmd.MerchantSerialNumber)
+	if err := c.validate(cmd); err != nil {
+		return nil, err
+	}
+	key, done, err := internal.IdempotencyKey(ctx, internal.Logger(c.APIClient), c.IdempotencyStore,
+		fmt.Sprintf("ecom.RefundPayment/%s/%s/%d", cmd.MerchantSerialNumber, cmd.OrderID, cmd.Amount.Minor), cmd.IdempotencyKey)
+	if err != nil {
+		return nil, err
+	}
 	endpoint := fmt.Sprintf("%s/%s/%s/refund", c.BaseURL, ecomEndpoint, cmd.OrderID)
 	method := http.MethodPost
 	res := RefundedPayment{}
@@ -164,8 +252,8 @@ func (c *Client) RefundPayment(ctx context.Context, cmd RefundPaymentCommand) (*
 			MerchantSerialNumber string `json:"merchantSerialNumber"`
 		} `json:"merchantInfo"`
 		Transaction struct {
-			Amount          int    `json:"amount"`
-			TransactionText string `json:"transactionText"`
+			Amount          vipps.Money `json:"amount"`
+			TransactionText string      `json:"transactionText"`
 		} `json:"transaction"`
 	}{}
 	command.MerchantInfo.MerchantSerialNumber = cmd.MerchantSerialNumber
@@ -176,11 +264,33 @@ func (c *Client) RefundPayment(ctx context.Context, cmd RefundPaymentCommand) (*
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Add("X-Request-ID", cmd.IdempotencyKey)
+	internal.SetMerchant(req, cmd.MerchantSerialNumber)
+	req.Header.Add("X-Request-ID", key)
 	err = c.APIClient.Do(req, &res)
+	done(err)
 	if err != nil {
 		return nil, wrapErr(err)
 	}
+	res.IdempotencyKey = key
 
 	return &res, nil
 }
+
+// merchant returns msn, or else the serial number carried by ctx or
+// configured for c.
+func (c *Client) merchant(ctx context.Context, msn string) string {
+	return internal.ResolveMerchant(ctx, msn, c.MerchantSerialNumber)
+}
+
+// validator is implemented by commands that can be validated before they are
+// sent.
+type validator interface {
+	Validate() error
+}
+
+func (c *Client) validate(cmd validator) error {
+	if c.SkipValidation {
+		return nil
+	}
+	return cmd.Validate()
+}
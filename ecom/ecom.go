@@ -3,7 +3,9 @@
 package ecom
 
 import (
+	"encoding/json"
 	"fmt"
+	"github.com/torfjor/go-vipps"
 	"time"
 )
 
@@ -20,11 +22,12 @@ func (t Timestamp) MarshalJSON() ([]byte, error) {
 // RefundPaymentCommand represents the command used to refund Vipps Ecom
 // payments
 type RefundPaymentCommand struct {
+	// IdempotencyKey, if empty, is generated by the Client.
 	IdempotencyKey       string
 	OrderID              string
 	MerchantSerialNumber string
 	TransactionText      string
-	Amount               int
+	Amount               vipps.Money
 }
 
 // RefundedPayment represents a refunded Vipps Ecom payment
@@ -32,15 +35,18 @@ type RefundedPayment struct {
 	OrderID            string             `json:"orderId"`
 	TransactionInfo    TransactionInfo    `json:"transaction"`
 	TransactionSummary TransactionSummary `json:"transactionSummary"`
+	// IdempotencyKey is the key that the request was sent with.
+	IdempotencyKey string `json:"-"`
 }
 
 // CapturePaymentCommand represents the command used to capture Vipps Ecom
 // payments
 type CapturePaymentCommand struct {
+	// IdempotencyKey, if empty, is generated by the Client.
 	IdempotencyKey       string
 	OrderID              string
 	MerchantSerialNumber string
-	Amount               int
+	Amount               vipps.Money
 	TransactionText      string
 }
 
@@ -49,6 +55,8 @@ type CapturedPayment struct {
 	OrderID            string             `json:"orderId"`
 	TransactionInfo    TransactionInfo    `json:"transactionInfo"`
 	TransactionSummary TransactionSummary `json:"transactionSummary"`
+	// IdempotencyKey is the key that the request was sent with.
+	IdempotencyKey string `json:"-"`
 }
 
 // CancelPaymentCommand represents the command used to cancel Vipps Ecom
@@ -90,16 +98,51 @@ type Payment struct {
 	UserDetails        UserDetails           `json:"userDetails,omitempty"`
 }
 
+// Operation is an operation recorded in the transaction log of a Vipps Ecom
+// payment.
+type Operation string
+
+// List of values that Operation can take.
+const (
+	OperationInitiate Operation = "INITIATE"
+	OperationReserve  Operation = "RESERVE"
+	OperationSale     Operation = "SALE"
+	OperationCapture  Operation = "CAPTURE"
+	OperationRefund   Operation = "REFUND"
+	OperationCancel   Operation = "CANCEL"
+	OperationVoid     Operation = "VOID"
+	OperationFailed   Operation = "FAILED"
+)
+
+// Known reports whether o is one of the documented operations.
+func (o Operation) Known() bool {
+	switch o {
+	case OperationInitiate, OperationReserve, OperationSale, OperationCapture,
+		OperationRefund, OperationCancel, OperationVoid, OperationFailed:
+		return true
+	}
+	return false
+}
+
+// UnmarshalJSON satisfies json.Unmarshaler. Unknown operations are kept as
+// is, so that they can be told apart with Known and handled in the default
+// case of a switch.
+func (o *Operation) UnmarshalJSON(b []byte) error {
+	s, err := unmarshalEnum(b)
+	*o = Operation(s)
+	return err
+}
+
 // TransactionLogEntry represents the list of transactions associated with a
 // payment
 type TransactionLogEntry struct {
-	Amount           int        `json:"amount"`
-	Operation        string     `json:"operation"`
-	OperationSuccess bool       `json:"operationSuccess"`
-	RequestID        string     `json:"requestId"`
-	Timestamp        *time.Time `json:"timeStamp"`
-	TransactionID    string     `json:"transactionId"`
-	TransactionText  string     `json:"transactionText"`
+	Amount           vipps.Money `json:"amount"`
+	Operation        Operation   `json:"operation"`
+	OperationSuccess bool        `json:"operationSuccess"`
+	RequestID        string      `json:"requestId"`
+	Timestamp        *time.Time  `json:"timeStamp"`
+	TransactionID    string      `json:"transactionId"`
+	TransactionText  string      `json:"transactionText"`
 }
 
 // UserDetails represents customer details from Vipps
@@ -116,10 +159,10 @@ type UserDetails struct {
 
 // ShippingDetails represents details for a shipping method
 type ShippingDetails struct {
-	Address          Address `json:"address,omitempty"`
-	ShippingCost     int     `json:"shippingCost,omitempty"`
-	ShippingMethod   string  `json:"shippingMethod,omitempty"`
-	ShippingMethodID string  `json:"shippingMethodId,omitempty"`
+	Address          Address     `json:"address,omitempty"`
+	ShippingCost     vipps.Money `json:"shippingCost"`
+	ShippingMethod   string      `json:"shippingMethod,omitempty"`
+	ShippingMethodID string      `json:"shippingMethodId,omitempty"`
 }
 
 // Address represents a Customer's shipping address
@@ -155,7 +198,8 @@ type MerchantInfo struct {
 	// updates.
 	AuthToken string `json:"authToken,omitempty"`
 	// MerchantSerialNumber uniquely represents a sales unit in the Vipps
-	// system.
+	// system. If empty, the serial number of the context or the Client is
+	// used.
 	MerchantSerialNumber string `json:"merchantSerialNumber"`
 	// CallbackURL is a publicly reachable HTTP endpoint that will receive
 	// transaction updates from Vipps.
@@ -190,13 +234,44 @@ const (
 )
 
 // StaticShippingMethod represents a static shipping method represented to the
-// user in the Vipps app.
+// user in the Vipps app. Unlike other amounts, ShippingCost is sent to and
+// from Vipps in kroner.
 type StaticShippingMethod struct {
-	IsDefault        YesNoEnum `json:"isDefault"`
-	Priority         int       `json:"priority"`
-	ShippingCost     float64   `json:"shippingCost"`
-	ShippingMethod   string    `json:"shippingMethod"`
-	ShippingMethodID string    `json:"shippingMethodId"`
+	IsDefault        YesNoEnum   `json:"isDefault"`
+	Priority         int         `json:"priority"`
+	ShippingCost     vipps.Money `json:"-"`
+	ShippingMethod   string      `json:"shippingMethod"`
+	ShippingMethodID string      `json:"shippingMethodId"`
+}
+
+// MarshalJSON satisfies json.Marshaler.
+func (m StaticShippingMethod) MarshalJSON() ([]byte, error) {
+	if m.ShippingCost.Minor < 0 {
+		return nil, vipps.ErrNegativeAmount
+	}
+	type method StaticShippingMethod
+	return json.Marshal(struct {
+		method
+		ShippingCost float64 `json:"shippingCost"`
+	}{method(m), m.ShippingCost.Kroner()})
+}
+
+// UnmarshalJSON satisfies json.Unmarshaler.
+func (m *StaticShippingMethod) UnmarshalJSON(b []byte) error {
+	type method StaticShippingMethod
+	v := struct {
+		*method
+		ShippingCost float64 `json:"shippingCost"`
+	}{method: (*method)(m)}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	cost, err := vipps.Kroner(v.ShippingCost)
+	if err != nil {
+		return err
+	}
+	m.ShippingCost = cost
+	return nil
 }
 
 // Transaction represents details for a Vipps Ecom payment.
@@ -204,8 +279,8 @@ type Transaction struct {
 	// OrderID represents the order that this payment refers to. Must be unique
 	// for each sales unit.
 	OrderID string `json:"orderId"`
-	// Amount is the amount (in cents) to be paid for the order.
-	Amount int `json:"amount"`
+	// Amount is the amount to be paid for the order.
+	Amount vipps.Money `json:"amount"`
 	// TransactionText is the short message displayed to the user about the
 	// payment in the Vipps app.
 	TransactionText string `json:"transactionText"`
@@ -217,21 +292,87 @@ type Transaction struct {
 // TransactionSummary represents a summary of captured, refunded and available
 // amounts on a Vipps Ecom payment.
 type TransactionSummary struct {
-	CapturedAmount           int `json:"capturedAmount"`
-	RefundedAmount           int `json:"refundedAmount"`
-	RemainingAmountToCapture int `json:"remainingAmountToCapture"`
-	RemainingAmountToRefund  int `json:"remainingAmountToRefund"`
-	BankIdentificationNumber int `json:"bankIdentificationNumber"`
+	CapturedAmount           vipps.Money `json:"capturedAmount"`
+	RefundedAmount           vipps.Money `json:"refundedAmount"`
+	RemainingAmountToCapture vipps.Money `json:"remainingAmountToCapture"`
+	RemainingAmountToRefund  vipps.Money `json:"remainingAmountToRefund"`
+	BankIdentificationNumber int         `json:"bankIdentificationNumber"`
+}
+
+// TransactionStatus is the status of a transaction, as reported in
+// transaction updates from Vipps and in responses to capture, refund and
+// cancel requests.
+type TransactionStatus string
+
+// List of values that TransactionStatus can take in TransactionUpdate.
+const (
+	// TransactionStatusReserved is sent when the user approved a payment of
+	// PaymentTypeRegular, and the amount is reserved.
+	TransactionStatusReserved TransactionStatus = "RESERVED"
+	// TransactionStatusSale is sent when the user approved a payment with
+	// direct capture, and the amount is captured.
+	TransactionStatusSale TransactionStatus = "SALE"
+	// TransactionStatusReserveFailed is sent when reserving the amount
+	// failed, e.g. because the card was declined.
+	TransactionStatusReserveFailed TransactionStatus = "RESERVE_FAILED"
+	// TransactionStatusSaleFailed is sent when a direct capture failed.
+	TransactionStatusSaleFailed TransactionStatus = "SALE_FAILED"
+	// TransactionStatusCancelled is sent when the user cancelled the
+	// payment in the Vipps app.
+	TransactionStatusCancelled TransactionStatus = "CANCELLED"
+	// TransactionStatusRejected is sent when the user did not act on the
+	// payment in time.
+	TransactionStatusRejected TransactionStatus = "REJECTED"
+)
+
+// List of values that TransactionStatus can take in responses to capture,
+// refund and cancel requests.
+const (
+	TransactionStatusCaptured          TransactionStatus = "Captured"
+	TransactionStatusRefunded          TransactionStatus = "Refund"
+	TransactionStatusMerchantCancelled TransactionStatus = "Cancelled"
+)
+
+// Known reports whether s is one of the documented transaction statuses.
+func (s TransactionStatus) Known() bool {
+	switch s {
+	case TransactionStatusReserved, TransactionStatusSale, TransactionStatusReserveFailed,
+		TransactionStatusSaleFailed, TransactionStatusCancelled, TransactionStatusRejected,
+		TransactionStatusCaptured, TransactionStatusRefunded, TransactionStatusMerchantCancelled:
+		return true
+	}
+	return false
+}
+
+// UnmarshalJSON satisfies json.Unmarshaler. Unknown statuses are kept as is,
+// so that they can be told apart with Known and handled in the default case of
+// a switch.
+func (s *TransactionStatus) UnmarshalJSON(b []byte) error {
+	v, err := unmarshalEnum(b)
+	*s = TransactionStatus(v)
+	return err
+}
+
+// unmarshalEnum decodes a JSON string, or null, as a string enum value.
+func unmarshalEnum(b []byte) (string, error) {
+	var s *string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return "", err
+	}
+	if s == nil {
+		return "", nil
+	}
+	return *s, nil
 }
 
 // TransactionInfo represents details about a Transaction in the Vipps Ecom
 // system.
 type TransactionInfo struct {
-	Amount          int        `json:"amount"`
-	Status          string     `json:"status"`
-	Timestamp       *time.Time `json:"timeStamp"`
-	TransactionID   string     `json:"transactionId"`
-	TransactionText string     `json:"transactionText"`
+	Amount          vipps.Money       `json:"amount"`
+	Status          TransactionStatus `json:"status"`
+	Timestamp       *time.Time        `json:"timeStamp"`
+	TransactionID   string            `json:"transactionId"`
+	TransactionText string            `json:"transactionText"`
 }
 
 // AddressType represents an address type
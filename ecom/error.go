@@ -29,17 +29,47 @@ func (e ErrEcom) Error() string {
 	return strings.Join(s, " ")
 }
 
+// ErrorCodes returns the error codes of e.
+func (e ErrEcom) ErrorCodes() []string {
+	codes := make([]string, len(e))
+	for i, e := range e {
+		codes[i] = e.Code
+	}
+	return codes
+}
+
+// errorKinds maps documented Ecom error codes to the errors they are
+// classified as.
+var errorKinds = map[string]error{
+	"35": vipps.ErrNotFound,
+	"61": vipps.ErrInsufficientReservedAmount,
+	"62": vipps.ErrInsufficientReservedAmount,
+	"63": vipps.ErrAlreadyCaptured,
+}
+
+// kind returns the error that the first classified error in e is classified
+// as.
+func (e ErrEcom) kind() error {
+	for _, e := range e {
+		if kind, ok := errorKinds[e.Code]; ok {
+			return kind
+		}
+	}
+	return nil
+}
+
 func wrapErr(err error) error {
 	if err, ok := err.(internal.HTTPError); ok {
 		var wrappedErr ErrEcom
 		unmarshalErr := json.Unmarshal(err.Body, &wrappedErr)
 		if unmarshalErr != nil {
-			return vipps.ErrUnexpectedResponse{
-				Body:   err.Body,
-				Status: err.Status,
-			}
+			return vipps.NewAPIError(err.Status, err.RequestID, nil, vipps.ErrUnexpectedResponse{
+				Body:      err.Body,
+				Status:    err.Status,
+				HTTPError: err,
+			})
 		}
-		return wrappedErr
+		return vipps.NewAPIError(err.Status, err.RequestID, wrappedErr.kind(), wrappedErr)
 	}
 	return err
 }
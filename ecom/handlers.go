@@ -1,24 +1,150 @@
 package ecom
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"github.com/go-kit/kit/log"
+	"github.com/torfjor/go-vipps"
 	"net/http"
 	"path"
 	"strings"
+	"time"
 )
 
+// HandlerOption configures the callback handlers of this package.
+type HandlerOption func(*handlerConfig)
+
+type handlerConfig struct {
+	auth    Authenticator
+	logger  log.Logger
+	timeout time.Duration
+	tracer  vipps.Tracer
+	metrics *vipps.Metrics
+}
+
+// WithAuthenticator makes a handler authorize requests with a. It takes
+// precedence over the authToken argument of the handler.
+func WithAuthenticator(a Authenticator) HandlerOption {
+	return func(c *handlerConfig) {
+		c.auth = a
+	}
+}
+
+// WithLogger makes a handler log rejected requests to logger, e.g. the Logger
+// of a vipps.ClientConfig.
+func WithLogger(logger log.Logger) HandlerOption {
+	return func(c *handlerConfig) {
+		c.logger = logger
+	}
+}
+
+// WithTimeout puts a deadline of d on the context passed to the callback of
+// the handlers that take one. If the callback fails because the deadline is
+// exceeded, the request fails with `503 Service Unavailable`.
+func WithTimeout(d time.Duration) HandlerOption {
+	return func(c *handlerConfig) {
+		c.timeout = d
+	}
+}
+
+// WithTracer makes a handler start a server span with tracer for every
+// callback, as a child of the span in the request context, if any. The
+// callback is called with a context carrying the span.
+func WithTracer(tracer vipps.Tracer) HandlerOption {
+	return func(c *handlerConfig) {
+		c.tracer = tracer
+	}
+}
+
+// WithMetrics makes HandleTransactionUpdate count the transaction updates it
+// receives, by status, with the Callbacks counter of m.
+func WithMetrics(m *vipps.Metrics) HandlerOption {
+	return func(c *handlerConfig) {
+		c.metrics = m
+	}
+}
+
+func newHandlerConfig(authToken string, opts []HandlerOption) *handlerConfig {
+	c := &handlerConfig{
+		logger: log.NewNopLogger(),
+	}
+	if authToken != "" {
+		c.auth = StaticTokens(authToken)
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// authorize authenticates r, if the handler has an Authenticator, and fails
+// the request if it is rejected.
+func (c *handlerConfig) authorize(w http.ResponseWriter, r *http.Request, orderID string) bool {
+	if c.auth == nil || c.auth.Authenticate(r, orderID) {
+		return true
+	}
+	c.logger.Log("msg", "rejected unauthorized callback", "method", r.Method, "url", r.URL, "order_id", orderID, "remote_addr", r.RemoteAddr)
+	http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	return false
+}
+
+// run calls cb with the request context, bounded by the handler's timeout and
+// carrying a span for operation, and fails the request if cb returns an
+// error, which it returns. Vipps retries callbacks that fail with a 5xx
+// status.
+func (c *handlerConfig) run(w http.ResponseWriter, r *http.Request, operation string, cb func(ctx context.Context) error, attrs ...vipps.Attribute) error {
+	ctx, span := vipps.StartSpan(r.Context(), c.tracer, vipps.SpanKindServer, operation, attrs...)
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+	err := cb(ctx)
+	vipps.EndSpan(span, err)
+	if err == nil {
+		return nil
+	}
+	c.logger.Log("msg", "callback failed", "method", r.Method, "url", r.URL, "err", err)
+	status := http.StatusInternalServerError
+	if errors.Is(err, context.DeadlineExceeded) {
+		status = http.StatusServiceUnavailable
+	}
+	http.Error(w, http.StatusText(status), status)
+	return err
+}
+
 // HandleConsentRemoval returns a convenience http.HandlerFunc for receiving
 // requests for user consent removals from Vipps. `cb` is called with the uid
 // of the user to that wishes to have its consents and data removed.
-func HandleConsentRemoval(cb func(uid string)) http.HandlerFunc {
+//
+// Requests are not authorized unless an Authenticator is given with
+// WithAuthenticator.
+func HandleConsentRemoval(cb func(uid string), opts ...HandlerOption) http.HandlerFunc {
+	return HandleConsentRemovalContext(func(ctx context.Context, uid string) error {
+		cb(uid)
+		return nil
+	}, opts...)
+}
+
+// HandleConsentRemovalContext is like HandleConsentRemoval, but `cb` is called
+// with the request context, and can fail the request by returning an error.
+// Vipps will then retry the request later.
+func HandleConsentRemovalContext(cb func(ctx context.Context, uid string) error, opts ...HandlerOption) http.HandlerFunc {
+	c := newHandlerConfig("", opts)
 	fn := func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodDelete {
 			w.Header().Set("Allow", "DELETE")
 			http.Error(w, "Unsupported method", http.StatusMethodNotAllowed)
 			return
 		}
+		if !c.authorize(w, r, "") {
+			return
+		}
 		uid := path.Base(r.URL.Path)
-		cb(uid)
+		c.run(w, r, "ecom.HandleConsentRemoval", func(ctx context.Context) error {
+			return cb(ctx, uid)
+		})
 	}
 
 	return fn
@@ -29,20 +155,29 @@ func HandleConsentRemoval(cb func(uid string)) http.HandlerFunc {
 //
 // The provided authToken, if not empty, will be matched with the
 // `Authorization` header of the incoming requests. If they don't match, the
-// request will fail.
-func HandleShippingDetails(authToken string, cb func(orderId string, req ShippingCostRequest) (ShippingCostResponse, error)) http.HandlerFunc {
+// request will fail. Use WithAuthenticator for other ways to authorize
+// requests.
+func HandleShippingDetails(authToken string, cb func(orderId string, req ShippingCostRequest) (ShippingCostResponse, error), opts ...HandlerOption) http.HandlerFunc {
+	return HandleShippingDetailsContext(authToken, func(ctx context.Context, orderId string, req ShippingCostRequest) (ShippingCostResponse, error) {
+		return cb(orderId, req)
+	}, opts...)
+}
+
+// HandleShippingDetailsContext is like HandleShippingDetails, but `cb` is
+// called with the request context, carrying the span of the callback, if any.
+func HandleShippingDetailsContext(authToken string, cb func(ctx context.Context, orderId string, req ShippingCostRequest) (ShippingCostResponse, error), opts ...HandlerOption) http.HandlerFunc {
+	c := newHandlerConfig(authToken, opts)
 	fn := func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			w.Header().Set("ALLOW", "POST")
 			http.Error(w, "Unsupported method", http.StatusMethodNotAllowed)
 			return
 		}
-		if authToken != "" && r.Header.Get("Authorization") != authToken {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
-			return
-		}
 		pathBySegments := strings.Split(r.URL.Path, "/")
 		orderId := pathBySegments[len(pathBySegments)-2]
+		if !c.authorize(w, r, orderId) {
+			return
+		}
 
 		bodyDec := json.NewDecoder(r.Body)
 		defer r.Body.Close()
@@ -54,9 +189,12 @@ func HandleShippingDetails(authToken string, cb func(orderId string, req Shippin
 			return
 		}
 
-		sh, err := cb(orderId, req)
+		var sh ShippingCostResponse
+		err = c.run(w, r, "ecom.HandleShippingDetails", func(ctx context.Context) (err error) {
+			sh, err = cb(ctx, orderId, req)
+			return err
+		}, vipps.OrderIDAttr(orderId))
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
@@ -76,20 +214,32 @@ func HandleShippingDetails(authToken string, cb func(orderId string, req Shippin
 //
 // The provided authToken, if not empty, will be matched with the
 // `Authorization` header of the incoming requests. If they don't match, the
-// request will fail.
+// request will fail. Use WithAuthenticator for other ways to authorize
+// requests.
 //
 // `cb` will be called with the TransactionUpdate. Please be aware that for
 // payments of PaymentTypeRegular, the fields `ShippingDetails` and
 // `UserDetails` will be nil.
-func HandleTransactionUpdate(authToken string, cb func(t TransactionUpdate)) http.HandlerFunc {
+func HandleTransactionUpdate(authToken string, cb func(t TransactionUpdate), opts ...HandlerOption) http.HandlerFunc {
+	return HandleTransactionUpdateContext(authToken, func(ctx context.Context, t TransactionUpdate) error {
+		cb(t)
+		return nil
+	}, opts...)
+}
+
+// HandleTransactionUpdateContext is like HandleTransactionUpdate, but `cb` is
+// called with the request context, and can fail the request by returning an
+// error. Vipps will then retry the transaction update later, so that it is not
+// lost if it could not be processed.
+func HandleTransactionUpdateContext(authToken string, cb func(ctx context.Context, t TransactionUpdate) error, opts ...HandlerOption) http.HandlerFunc {
+	c := newHandlerConfig(authToken, opts)
 	fn := func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			w.Header().Set("ALLOW", "POST")
 			http.Error(w, "Unsupported method", http.StatusMethodNotAllowed)
 			return
 		}
-		if authToken != "" && r.Header.Get("Authorization") != authToken {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		if !c.authorize(w, r, path.Base(r.URL.Path)) {
 			return
 		}
 		var t TransactionUpdate
@@ -102,7 +252,14 @@ func HandleTransactionUpdate(authToken string, cb func(t TransactionUpdate)) htt
 			return
 		}
 
-		cb(t)
+		attrs := []vipps.Attribute{vipps.OrderIDAttr(t.OrderID)}
+		if t.TransactionInfo != nil {
+			attrs = append(attrs, vipps.Attribute{Key: vipps.AttributeTransactionStatus, Value: string(t.TransactionInfo.Status)})
+			c.metrics.CountCallback(string(t.TransactionInfo.Status))
+		}
+		c.run(w, r, "ecom.HandleTransactionUpdate", func(ctx context.Context) error {
+			return cb(ctx, t)
+		}, attrs...)
 	}
 	return fn
 }
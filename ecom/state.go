@@ -0,0 +1,190 @@
+package ecom
+
+import (
+	"github.com/torfjor/go-vipps"
+	"sort"
+	"time"
+)
+
+// InitiationTimeout is how long the user has to act on an initiated payment
+// before Vipps considers it expired.
+const InitiationTimeout = 5 * time.Minute
+
+// PaymentState is the state of a Payment, as derived from its transaction log.
+type PaymentState string
+
+// List of values that PaymentState can take.
+const (
+	PaymentStateInitiated         PaymentState = "INITIATED"
+	PaymentStateReserved          PaymentState = "RESERVED"
+	PaymentStatePartiallyCaptured PaymentState = "PARTIALLY_CAPTURED"
+	PaymentStateCaptured          PaymentState = "CAPTURED"
+	PaymentStatePartiallyRefunded PaymentState = "PARTIALLY_REFUNDED"
+	PaymentStateRefunded          PaymentState = "REFUNDED"
+	PaymentStateCancelled         PaymentState = "CANCELLED"
+	PaymentStateVoided            PaymentState = "VOIDED"
+	PaymentStateFailed            PaymentState = "FAILED"
+	PaymentStateExpired           PaymentState = "EXPIRED"
+)
+
+// Terminal reports whether no further operations are possible on a payment in
+// state s.
+func (s PaymentState) Terminal() bool {
+	switch s {
+	case PaymentStateRefunded, PaymentStateCancelled, PaymentStateVoided, PaymentStateFailed, PaymentStateExpired:
+		return true
+	}
+	return false
+}
+
+// PaymentStatus is the result of folding the transaction log of a payment: its
+// current state, the amounts reserved, captured and refunded, and the
+// operations that are legal next: OperationCapture, OperationRefund and
+// OperationCancel.
+type PaymentStatus struct {
+	State          PaymentState
+	ReservedAmount vipps.Money
+	CapturedAmount vipps.Money
+	RefundedAmount vipps.Money
+	Next           []Operation
+}
+
+// Allows reports whether op is a legal next operation.
+func (s PaymentStatus) Allows(op Operation) bool {
+	for _, next := range s.Next {
+		if next == op {
+			return true
+		}
+	}
+	return false
+}
+
+// RemainingAmountToCapture returns the reserved amount that is not captured,
+// if the reservation is still open.
+func (s PaymentStatus) RemainingAmountToCapture() vipps.Money {
+	if !s.Allows(OperationCapture) {
+		return vipps.Ore(0)
+	}
+	return remaining(s.ReservedAmount, s.CapturedAmount)
+}
+
+// RemainingAmountToRefund returns the captured amount that is not refunded.
+func (s PaymentStatus) RemainingAmountToRefund() vipps.Money {
+	return remaining(s.CapturedAmount, s.RefundedAmount)
+}
+
+// remaining returns total - used, or zero if used exceeds total.
+func remaining(total, used vipps.Money) vipps.Money {
+	m, err := total.Sub(used)
+	if err != nil {
+		return vipps.Ore(0)
+	}
+	return m
+}
+
+// FoldTransactionLog derives the PaymentStatus of a payment from its
+// transaction log, as of time now. Entries are applied in chronological order
+// and unsuccessful operations are ignored. A payment that is still only
+// initiated after InitiationTimeout is expired.
+func FoldTransactionLog(log []TransactionLogEntry, now time.Time) PaymentStatus {
+	var (
+		s = PaymentStatus{
+			ReservedAmount: vipps.Ore(0),
+			CapturedAmount: vipps.Ore(0),
+			RefundedAmount: vipps.Ore(0),
+		}
+		initiatedAt *time.Time
+		// open is whether the reservation can still be captured or
+		// cancelled.
+		open bool
+	)
+	for _, e := range chronological(log) {
+		if !e.OperationSuccess {
+			continue
+		}
+		switch e.Operation {
+		case OperationInitiate:
+			s.State = PaymentStateInitiated
+			s.ReservedAmount = e.Amount
+			initiatedAt = e.Timestamp
+		case OperationReserve:
+			s.State = PaymentStateReserved
+			s.ReservedAmount = e.Amount
+			open = true
+		case OperationSale:
+			s.State = PaymentStateCaptured
+			s.ReservedAmount = e.Amount
+			s.CapturedAmount = e.Amount
+			open = false
+		case OperationCapture:
+			s.CapturedAmount.Minor += e.Amount.Minor
+			s.State = PaymentStatePartiallyCaptured
+			if s.CapturedAmount.Minor >= s.ReservedAmount.Minor {
+				s.State = PaymentStateCaptured
+				open = false
+			}
+		case OperationRefund:
+			s.RefundedAmount.Minor += e.Amount.Minor
+			s.State = PaymentStatePartiallyRefunded
+			if s.RefundedAmount.Minor >= s.CapturedAmount.Minor && !open {
+				s.State = PaymentStateRefunded
+			}
+		case OperationCancel:
+			s.State = PaymentStateCancelled
+			open = false
+		case OperationVoid:
+			s.State = PaymentStateVoided
+			open = false
+		case OperationFailed:
+			s.State = PaymentStateFailed
+			open = false
+		}
+	}
+
+	if s.State == PaymentStateInitiated && initiatedAt != nil && now.Sub(*initiatedAt) > InitiationTimeout {
+		s.State = PaymentStateExpired
+	}
+
+	switch {
+	case s.State == PaymentStateInitiated:
+		s.Next = append(s.Next, OperationCancel)
+	case open:
+		s.Next = append(s.Next, OperationCapture)
+		if s.CapturedAmount.IsZero() {
+			s.Next = append(s.Next, OperationCancel)
+		}
+	}
+	if !s.RemainingAmountToRefund().IsZero() {
+		s.Next = append(s.Next, OperationRefund)
+	}
+	return s
+}
+
+// Status returns the current PaymentStatus of the payment, derived from its
+// transaction log.
+func (p *Payment) Status() PaymentStatus {
+	return FoldTransactionLog(p.TransactionLog, time.Now())
+}
+
+// State returns the current state of the payment, derived from its
+// transaction log. It is empty if the log has no successful operations.
+func (p *Payment) State() PaymentState {
+	return p.Status().State
+}
+
+// chronological returns a copy of log sorted by time, oldest first. Vipps
+// lists the most recent entry first, so entries without a timestamp keep
+// their reversed relative order.
+func chronological(log []TransactionLogEntry) []TransactionLogEntry {
+	res := make([]TransactionLogEntry, len(log))
+	for i, e := range log {
+		res[len(log)-1-i] = e
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		if res[i].Timestamp == nil || res[j].Timestamp == nil {
+			return false
+		}
+		return res[i].Timestamp.Before(*res[j].Timestamp)
+	})
+	return res
+}
@@ -0,0 +1,266 @@
+package ecom
+
+import (
+	"github.com/torfjor/go-vipps"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFoldTransactionLog(t *testing.T) {
+	start := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	at := func(minutes int) *time.Time {
+		t := start.Add(time.Duration(minutes) * time.Minute)
+		return &t
+	}
+	entry := func(op Operation, ore int64, minutes int) TransactionLogEntry {
+		return TransactionLogEntry{
+			Amount:           vipps.Ore(ore),
+			Operation:        op,
+			OperationSuccess: true,
+			Timestamp:        at(minutes),
+		}
+	}
+	failed := func(e TransactionLogEntry) TransactionLogEntry {
+		e.OperationSuccess = false
+		return e
+	}
+	// Vipps lists the most recent entry first.
+	newestFirst := func(entries ...TransactionLogEntry) []TransactionLogEntry {
+		res := make([]TransactionLogEntry, len(entries))
+		for i, e := range entries {
+			res[len(entries)-1-i] = e
+		}
+		return res
+	}
+
+	tests := []struct {
+		name     string
+		log      []TransactionLogEntry
+		now      time.Time
+		want     PaymentState
+		reserved int64
+		captured int64
+		refunded int64
+		next     []Operation
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name:     "initiated",
+			log:      newestFirst(entry(OperationInitiate, 1000, 0)),
+			now:      *at(1),
+			want:     PaymentStateInitiated,
+			reserved: 1000,
+			next:     []Operation{OperationCancel},
+		},
+		{
+			name:     "expired",
+			log:      newestFirst(entry(OperationInitiate, 1000, 0)),
+			now:      *at(6),
+			want:     PaymentStateExpired,
+			reserved: 1000,
+		},
+		{
+			name:     "reserved",
+			log:      newestFirst(entry(OperationInitiate, 1000, 0), entry(OperationReserve, 1000, 1)),
+			now:      *at(10),
+			want:     PaymentStateReserved,
+			reserved: 1000,
+			next:     []Operation{OperationCapture, OperationCancel},
+		},
+		{
+			name: "partially captured",
+			log: newestFirst(
+				entry(OperationInitiate, 1000, 0),
+				entry(OperationReserve, 1000, 1),
+				entry(OperationCapture, 400, 2),
+			),
+			want:     PaymentStatePartiallyCaptured,
+			reserved: 1000,
+			captured: 400,
+			next:     []Operation{OperationCapture, OperationRefund},
+		},
+		{
+			name: "captured",
+			log: newestFirst(
+				entry(OperationInitiate, 1000, 0),
+				entry(OperationReserve, 1000, 1),
+				entry(OperationCapture, 400, 2),
+				entry(OperationCapture, 600, 3),
+			),
+			want:     PaymentStateCaptured,
+			reserved: 1000,
+			captured: 1000,
+			next:     []Operation{OperationRefund},
+		},
+		{
+			name: "sale",
+			log: newestFirst(
+				entry(OperationInitiate, 1000, 0),
+				entry(OperationSale, 1000, 1),
+			),
+			want:     PaymentStateCaptured,
+			reserved: 1000,
+			captured: 1000,
+			next:     []Operation{OperationRefund},
+		},
+		{
+			name: "partially refunded",
+			log: newestFirst(
+				entry(OperationInitiate, 1000, 0),
+				entry(OperationReserve, 1000, 1),
+				entry(OperationCapture, 1000, 2),
+				entry(OperationRefund, 300, 3),
+			),
+			want:     PaymentStatePartiallyRefunded,
+			reserved: 1000,
+			captured: 1000,
+			refunded: 300,
+			next:     []Operation{OperationRefund},
+		},
+		{
+			name: "refunded",
+			log: newestFirst(
+				entry(OperationInitiate, 1000, 0),
+				entry(OperationReserve, 1000, 1),
+				entry(OperationCapture, 1000, 2),
+				entry(OperationRefund, 1000, 3),
+			),
+			want:     PaymentStateRefunded,
+			reserved: 1000,
+			captured: 1000,
+			refunded: 1000,
+		},
+		{
+			name: "refund of partial capture keeps reservation open",
+			log: newestFirst(
+				entry(OperationInitiate, 1000, 0),
+				entry(OperationReserve, 1000, 1),
+				entry(OperationCapture, 400, 2),
+				entry(OperationRefund, 400, 3),
+			),
+			want:     PaymentStatePartiallyRefunded,
+			reserved: 1000,
+			captured: 400,
+			refunded: 400,
+			next:     []Operation{OperationCapture},
+		},
+		{
+			name: "cancelled",
+			log: newestFirst(
+				entry(OperationInitiate, 1000, 0),
+				entry(OperationReserve, 1000, 1),
+				entry(OperationCancel, 0, 2),
+			),
+			want:     PaymentStateCancelled,
+			reserved: 1000,
+		},
+		{
+			name: "voided",
+			log: newestFirst(
+				entry(OperationInitiate, 1000, 0),
+				entry(OperationReserve, 1000, 1),
+				entry(OperationVoid, 0, 2),
+			),
+			want:     PaymentStateVoided,
+			reserved: 1000,
+		},
+		{
+			name: "failed capture is ignored",
+			log: newestFirst(
+				entry(OperationInitiate, 1000, 0),
+				entry(OperationReserve, 1000, 1),
+				failed(entry(OperationCapture, 1000, 2)),
+			),
+			want:     PaymentStateReserved,
+			reserved: 1000,
+			next:     []Operation{OperationCapture, OperationCancel},
+		},
+		{
+			name: "out of order",
+			log: []TransactionLogEntry{
+				entry(OperationReserve, 1000, 1),
+				entry(OperationCapture, 1000, 2),
+				entry(OperationInitiate, 1000, 0),
+			},
+			want:     PaymentStateCaptured,
+			reserved: 1000,
+			captured: 1000,
+			next:     []Operation{OperationRefund},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := tt.now
+			if now.IsZero() {
+				now = *at(60)
+			}
+			s := FoldTransactionLog(tt.log, now)
+			if s.State != tt.want {
+				t.Errorf("State = %q, want %q", s.State, tt.want)
+			}
+			if s.ReservedAmount.Minor != tt.reserved || s.CapturedAmount.Minor != tt.captured || s.RefundedAmount.Minor != tt.refunded {
+				t.Errorf("amounts = %v/%v/%v, want %v/%v/%v",
+					s.ReservedAmount.Minor, s.CapturedAmount.Minor, s.RefundedAmount.Minor,
+					tt.reserved, tt.captured, tt.refunded)
+			}
+			if !reflect.DeepEqual(s.Next, tt.next) {
+				t.Errorf("Next = %v, want %v", s.Next, tt.next)
+			}
+		})
+	}
+}
+
+func TestPaymentStatusRemaining(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      PaymentStatus
+		wantCapture int64
+		wantRefund  int64
+	}{
+		{
+			name: "open reservation",
+			status: PaymentStatus{
+				ReservedAmount: vipps.Ore(1000),
+				CapturedAmount: vipps.Ore(400),
+				RefundedAmount: vipps.Ore(100),
+				Next:           []Operation{OperationCapture, OperationRefund},
+			},
+			wantCapture: 600,
+			wantRefund:  300,
+		},
+		{
+			name: "closed reservation",
+			status: PaymentStatus{
+				ReservedAmount: vipps.Ore(1000),
+				CapturedAmount: vipps.Ore(400),
+				RefundedAmount: vipps.Ore(0),
+				Next:           []Operation{OperationRefund},
+			},
+			wantCapture: 0,
+			wantRefund:  400,
+		},
+		{
+			name: "over-refunded",
+			status: PaymentStatus{
+				ReservedAmount: vipps.Ore(1000),
+				CapturedAmount: vipps.Ore(400),
+				RefundedAmount: vipps.Ore(500),
+			},
+			wantCapture: 0,
+			wantRefund:  0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.status.RemainingAmountToCapture().Minor; got != tt.wantCapture {
+				t.Errorf("RemainingAmountToCapture = %d, want %d", got, tt.wantCapture)
+			}
+			if got := tt.status.RemainingAmountToRefund().Minor; got != tt.wantRefund {
+				t.Errorf("RemainingAmountToRefund = %d, want %d", got, tt.wantRefund)
+			}
+		})
+	}
+}
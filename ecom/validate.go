@@ -0,0 +1,74 @@
+package ecom
+
+import (
+	"github.com/torfjor/go-vipps"
+	"github.com/torfjor/go-vipps/internal"
+	"strconv"
+)
+
+// maxTransactionTextLength is the maximum length of a transaction text.
+const maxTransactionTextLength = 100
+
+// Validate checks cmd against the rules documented for the Ecom API. It
+// returns a *vipps.ValidationError listing every invalid field.
+func (cmd InitiatePaymentCommand) Validate() error {
+	var e vipps.ValidationError
+	mi := cmd.MerchantInfo
+	e.Check(mi.MerchantSerialNumber != "", "merchantInfo.merchantSerialNumber", "is required")
+	e.Check(internal.IsHTTPS(mi.CallbackURL), "merchantInfo.callbackPrefix", "must be an https URL")
+	e.Check(mi.RedirectURL != "", "merchantInfo.fallBack", "is required")
+	e.Check(mi.IsApp || mi.RedirectURL == "" || internal.IsHTTPS(mi.RedirectURL), "merchantInfo.fallBack", "must be an https URL")
+	e.Check(mi.ConsentRemovalURL == "" || internal.IsHTTPS(mi.ConsentRemovalURL), "merchantInfo.consentRemovalPrefix", "must be an https URL")
+	e.Check(mi.ShippingDetailsURL == "" || internal.IsHTTPS(mi.ShippingDetailsURL), "merchantInfo.shippingDetailsPrefix", "must be an https URL")
+	for i, m := range mi.ShippingMethods {
+		e.Check(m.ShippingCost.Minor >= 0, "merchantInfo.staticShippingDetails["+strconv.Itoa(i)+"].shippingCost", "cannot be negative")
+	}
+	if n := cmd.CustomerInfo.MobileNumber; n != 0 {
+		e.Check(internal.ValidMobileNumber(strconv.Itoa(n)), "customerInfo.mobileNumber", "must be an 8 digit Norwegian mobile number")
+	}
+	e.Check(internal.ValidOrderID(cmd.Transaction.OrderID), "transaction.orderId", "must be 1 to 50 characters a-z, A-Z, 0-9 or -")
+	e.Check(cmd.Transaction.Amount.Minor > 0, "transaction.amount", "must be positive")
+	checkTransactionText(&e, cmd.Transaction.TransactionText)
+	return e.Err()
+}
+
+// Validate checks cmd against the rules documented for the Ecom API. It
+// returns a *vipps.ValidationError listing every invalid field. A zero Amount
+// is valid, and captures the remaining reserved amount.
+func (cmd CapturePaymentCommand) Validate() error {
+	var e vipps.ValidationError
+	checkOrder(&e, cmd.OrderID, cmd.MerchantSerialNumber)
+	e.Check(cmd.Amount.Minor >= 0, "transaction.amount", "cannot be negative")
+	checkTransactionText(&e, cmd.TransactionText)
+	return e.Err()
+}
+
+// Validate checks cmd against the rules documented for the Ecom API. It
+// returns a *vipps.ValidationError listing every invalid field.
+func (cmd RefundPaymentCommand) Validate() error {
+	var e vipps.ValidationError
+	checkOrder(&e, cmd.OrderID, cmd.MerchantSerialNumber)
+	e.Check(cmd.Amount.Minor > 0, "transaction.amount", "must be positive")
+	checkTransactionText(&e, cmd.TransactionText)
+	return e.Err()
+}
+
+// Validate checks cmd against the rules documented for the Ecom API. It
+// returns a *vipps.ValidationError listing every invalid field.
+func (cmd CancelPaymentCommand) Validate() error {
+	var e vipps.ValidationError
+	checkOrder(&e, cmd.OrderID, cmd.MerchantSerialNumber)
+	checkTransactionText(&e, cmd.TransactionText)
+	return e.Err()
+}
+
+func checkOrder(e *vipps.ValidationError, orderID, merchantSerialNumber string) {
+	e.Check(internal.ValidOrderID(orderID), "orderId", "must be 1 to 50 characters a-z, A-Z, 0-9 or -")
+	e.Check(merchantSerialNumber != "", "merchantInfo.merchantSerialNumber", "is required")
+}
+
+func checkTransactionText(e *vipps.ValidationError, text string) {
+	e.Check(text != "", "transaction.transactionText", "is required")
+	e.Check(internal.MaxLength(text, maxTransactionTextLength), "transaction.transactionText",
+		"must be at most "+strconv.Itoa(maxTransactionTextLength)+" characters")
+}
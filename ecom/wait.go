@@ -0,0 +1,102 @@
+package ecom
+
+import (
+	"context"
+	"github.com/torfjor/go-vipps"
+	"time"
+)
+
+// Defaults for WaitOptions.
+const (
+	DefaultMinPollInterval = time.Second
+	DefaultMaxPollInterval = 10 * time.Second
+)
+
+// WaitOptions configures Client.WaitForPayment.
+type WaitOptions struct {
+	// Until lists the states to wait for, in addition to terminal states.
+	// Defaults to PaymentStateReserved and PaymentStateCaptured, i.e. until
+	// the user has approved the payment.
+	Until []PaymentState
+	// MinInterval is the initial interval between polls. It doubles after
+	// every poll without a state change, up to MaxInterval.
+	MinInterval time.Duration
+	MaxInterval time.Duration
+	// Changes, if set, receives the payment every time its state changes,
+	// including the first poll. It is closed when WaitForPayment returns.
+	Changes chan<- *Payment
+}
+
+// WaitForPayment polls the details of the payment for orderID until it
+// reaches one of the states in opts.Until or a terminal state, and returns it.
+// Polling stops with an error if ctx is done or getting the payment fails.
+//
+// Callbacks from Vipps may be delayed or lost, so WaitForPayment is useful to
+// learn the outcome of a payment after the user is redirected back.
+func (c *Client) WaitForPayment(ctx context.Context, orderID string, opts WaitOptions) (_ *Payment, err error) {
+	ctx, span := vipps.StartSpan(ctx, c.Tracer, vipps.SpanKindClient, "ecom.WaitForPayment", vipps.OrderIDAttr(orderID))
+	defer func() { vipps.EndSpan(span, err) }()
+
+	if opts.Changes != nil {
+		defer close(opts.Changes)
+	}
+	until := opts.Until
+	if len(until) == 0 {
+		until = []PaymentState{PaymentStateReserved, PaymentStateCaptured}
+	}
+	min, max := opts.MinInterval, opts.MaxInterval
+	if min <= 0 {
+		min = DefaultMinPollInterval
+	}
+	if max < min {
+		max = DefaultMaxPollInterval
+		if max < min {
+			max = min
+		}
+	}
+
+	var last PaymentState
+	interval := min
+	for first := true; ; first = false {
+		p, err := c.GetPayment(ctx, orderID)
+		if err != nil {
+			return nil, err
+		}
+
+		state := p.State()
+		if first || state != last {
+			last = state
+			interval = min
+			if opts.Changes != nil {
+				select {
+				case opts.Changes <- p:
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				}
+			}
+		}
+		if state.Terminal() || containsState(until, state) {
+			return p, nil
+		}
+
+		t := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return nil, ctx.Err()
+		case <-t.C:
+		}
+		if interval *= 2; interval > max {
+			interval = max
+		}
+	}
+}
+
+func containsState(states []PaymentState, s PaymentState) bool {
+	for _, state := range states {
+		if state == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,121 @@
+package epayment
+
+import (
+	"encoding/json"
+	"github.com/torfjor/go-vipps"
+	"github.com/torfjor/go-vipps/internal"
+)
+
+// amount is how the ePayment API represents a vipps.Money.
+type amount = internal.Amount
+
+func toAmount(m vipps.Money) (amount, error) {
+	if m.Minor < 0 {
+		return amount{}, vipps.ErrNegativeAmount
+	}
+	c := m.Currency
+	if c == "" {
+		c = vipps.CurrencyNOK
+	}
+	return amount{Currency: string(c), Value: m.Minor}, nil
+}
+
+// money returns a as a vipps.Money.
+func money(a amount) vipps.Money {
+	return vipps.Money{Minor: a.Value, Currency: vipps.Currency(a.Currency)}
+}
+
+// MarshalJSON satisfies json.Marshaler.
+func (c CreatePaymentCommand) MarshalJSON() ([]byte, error) {
+	type alias CreatePaymentCommand
+	a, err := toAmount(c.Amount)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(struct {
+		alias
+		Amount amount `json:"amount"`
+	}{alias(c), a})
+}
+
+// MarshalJSON satisfies json.Marshaler.
+func (c CapturePaymentCommand) MarshalJSON() ([]byte, error) {
+	return marshalModification(c.ModificationAmount)
+}
+
+// MarshalJSON satisfies json.Marshaler.
+func (c RefundPaymentCommand) MarshalJSON() ([]byte, error) {
+	return marshalModification(c.ModificationAmount)
+}
+
+func marshalModification(m vipps.Money) ([]byte, error) {
+	a, err := toAmount(m)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(struct {
+		ModificationAmount amount `json:"modificationAmount"`
+	}{a})
+}
+
+// UnmarshalJSON satisfies json.Unmarshaler.
+func (a *Aggregate) UnmarshalJSON(b []byte) error {
+	var v struct {
+		AuthorizedAmount amount `json:"authorizedAmount"`
+		CancelledAmount  amount `json:"cancelledAmount"`
+		CapturedAmount   amount `json:"capturedAmount"`
+		RefundedAmount   amount `json:"refundedAmount"`
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	*a = Aggregate{
+		AuthorizedAmount: money(v.AuthorizedAmount),
+		CancelledAmount:  money(v.CancelledAmount),
+		CapturedAmount:   money(v.CapturedAmount),
+		RefundedAmount:   money(v.RefundedAmount),
+	}
+	return nil
+}
+
+// UnmarshalJSON satisfies json.Unmarshaler.
+func (p *Payment) UnmarshalJSON(b []byte) error {
+	type alias Payment
+	v := struct {
+		*alias
+		Amount amount `json:"amount"`
+	}{alias: (*alias)(p)}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	p.Amount = money(v.Amount)
+	return nil
+}
+
+// UnmarshalJSON satisfies json.Unmarshaler.
+func (e *Event) UnmarshalJSON(b []byte) error {
+	type alias Event
+	v := struct {
+		*alias
+		Amount amount `json:"amount"`
+	}{alias: (*alias)(e)}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	e.Amount = money(v.Amount)
+	return nil
+}
+
+// UnmarshalJSON satisfies json.Unmarshaler.
+func (p *ModifiedPayment) UnmarshalJSON(b []byte) error {
+	type alias ModifiedPayment
+	v := struct {
+		*alias
+		Amount amount `json:"amount"`
+	}{alias: (*alias)(p)}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	p.Amount = money(v.Amount)
+	return nil
+}
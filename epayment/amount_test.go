@@ -0,0 +1,80 @@
+package epayment
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/torfjor/go-vipps"
+	"testing"
+)
+
+func TestAmountJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		v       interface{}
+		want    string
+		wantErr error
+	}{
+		{
+			name: "capture",
+			v:    CapturePaymentCommand{ModificationAmount: vipps.Ore(1000)},
+			want: `{"modificationAmount":{"currency":"NOK","value":1000}}`,
+		},
+		{
+			name: "refund in empty currency",
+			v:    RefundPaymentCommand{ModificationAmount: vipps.Money{Minor: 500}},
+			want: `{"modificationAmount":{"currency":"NOK","value":500}}`,
+		},
+		{
+			name:    "negative",
+			v:       CapturePaymentCommand{ModificationAmount: vipps.Ore(-1)},
+			wantErr: vipps.ErrNegativeAmount,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := json.Marshal(tt.v)
+			if !errors.Is(err, tt.wantErr) || string(b) != tt.want {
+				t.Errorf("Marshal = %s, %v, want %s, %v", b, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCreatePaymentCommandAmount(t *testing.T) {
+	b, err := json.Marshal(CreatePaymentCommand{Amount: vipps.Money{Minor: 1234, Currency: "SEK"}, Reference: "reference-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v struct {
+		Amount    amount `json:"amount"`
+		Reference string `json:"reference"`
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		t.Fatal(err)
+	}
+	if want := (amount{Currency: "SEK", Value: 1234}); v.Amount != want || v.Reference != "reference-1" {
+		t.Errorf("Marshal = %s, want amount %v and reference", b, want)
+	}
+}
+
+func TestAggregateUnmarshal(t *testing.T) {
+	var p Payment
+	err := json.Unmarshal([]byte(`{
+		"amount": {"currency": "NOK", "value": 1000},
+		"aggregate": {
+			"authorizedAmount": {"currency": "NOK", "value": 1000},
+			"capturedAmount": {"currency": "NOK", "value": 400},
+			"refundedAmount": {"currency": "NOK", "value": 100}
+		}
+	}`), &p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Amount != vipps.Ore(1000) {
+		t.Errorf("Amount = %v, want %v", p.Amount, vipps.Ore(1000))
+	}
+	a := p.Aggregate
+	if a.AuthorizedAmount != vipps.Ore(1000) || a.CapturedAmount != vipps.Ore(400) || a.RefundedAmount != vipps.Ore(100) {
+		t.Errorf("Aggregate = %+v", a)
+	}
+}
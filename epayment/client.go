@@ -0,0 +1,288 @@
+package epayment
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-kit/kit/log"
+	"github.com/torfjor/go-vipps"
+	"github.com/torfjor/go-vipps/auth"
+	"github.com/torfjor/go-vipps/internal"
+	"net/http"
+	"net/url"
+)
+
+type Doer interface {
+	Do(req *http.Request, v interface{}) error
+	NewRequest(ctx context.Context, method, endpoint string, body interface{}) (*http.Request, error)
+}
+
+// Client represents an API client for the Vipps ePayment v1 API.
+type Client struct {
+	BaseURL   string
+	APIClient Doer
+	// SkipValidation disables the validation of commands before they are
+	// sent.
+	SkipValidation bool
+	// Tracer, if set, traces every call on the Client.
+	Tracer vipps.Tracer
+	// MerchantSerialNumber is used for commands that have none, unless the
+	// context of the call carries one, see vipps.ContextWithMerchant.
+	MerchantSerialNumber string
+	// IdempotencyStore, if set, remembers the idempotency keys generated for
+	// commands that have none.
+	IdempotencyStore vipps.IdempotencyStore
+}
+
+// NewClient returns a configured Client. It panics if config has no
+// HTTPClient, or an unknown Environment and no BaseURL. An empty Environment
+// means production. Use New to get an error instead.
+func NewClient(config vipps.ClientConfig) *Client {
+	if config.HTTPClient == nil {
+		panic("config.HTTPClient cannot be nil")
+	}
+	c, err := newClient(config)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// New returns a Client configured with opts, or an error if the configuration
+// is invalid. Unless it is given a HTTPClient, the Client authenticates with
+// the Credentials, see auth.NewFromConfig.
+func New(opts ...vipps.Option) (*Client, error) {
+	config, err := vipps.NewConfig(opts...)
+	if err != nil {
+		return nil, err
+	}
+	if config.HTTPClient == nil {
+		if config.HTTPClient, err = auth.NewFromConfig(config); err != nil {
+			return nil, err
+		}
+	}
+	return newClient(config)
+}
+
+func newClient(config vipps.ClientConfig) (*Client, error) {
+	var logger log.Logger
+
+	baseUrl, err := config.APIBaseURL()
+	if err != nil {
+		return nil, err
+	}
+
+	if config.Logger == nil {
+		logger = log.NewNopLogger()
+	} else {
+		logger = config.Logger
+	}
+
+	return &Client{
+		BaseURL: baseUrl,
+		APIClient: &internal.APIClient{
+			L: logger,
+			C: config.Doer(),
+			R: (*internal.RetryPolicy)(config.RetryPolicy),
+			H: config.Headers(),
+		},
+		SkipValidation:       config.SkipValidation,
+		Tracer:               config.Tracer,
+		MerchantSerialNumber: config.MerchantSerialNumber,
+		IdempotencyStore:     config.IdempotencyStore,
+	}, nil
+}
+
+// CreatePayment creates a new Payment and returns a reference to where the
+// user can continue the payment flow.
+func (c *Client) CreatePayment(ctx context.Context, cmd CreatePaymentCommand) (_ *PaymentReference, err error) {
+	ctx, span := vipps.StartSpan(ctx, c.Tracer, vipps.SpanKindClient, "epayment.CreatePayment", vipps.ReferenceAttr(cmd.Reference))
+	defer func() { vipps.EndSpan(span, err) }()
+
+	cmd.MerchantSerialNumber = c.merchant(ctx, cmd.MerchantSerialNumber)
+	if err := c.validate(cmd); err != nil {
+		return nil, err
+	}
+	key, done, err := internal.IdempotencyKey(ctx, internal.Logger(c.APIClient), c.IdempotencyStore,
+		fmt.Sprintf("epayment.CreatePayment/%s/%s", cmd.MerchantSerialNumber, cmd.Reference), cmd.IdempotencyKey)
+	if err != nil {
+		return nil, err
+	}
+	endpoint := fmt.Sprintf("%s/%s/payments", c.BaseURL, epaymentEndpoint)
+	method := http.MethodPost
+	res := PaymentReference{}
+
+	req, err := c.APIClient.NewRequest(ctx, method, endpoint, cmd)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Idempotency-Key", key)
+	internal.SetMerchant(req, cmd.MerchantSerialNumber)
+
+	err = c.APIClient.Do(req, &res)
+	done(err)
+	if err != nil {
+		return nil, wrapErr(err)
+	}
+	res.IdempotencyKey = key
+
+	return &res, nil
+}
+
+// GetPayment gets a Payment.
+func (c *Client) GetPayment(ctx context.Context, reference string) (_ *Payment, err error) {
+	ctx, span := vipps.StartSpan(ctx, c.Tracer, vipps.SpanKindClient, "epayment.GetPayment", vipps.ReferenceAttr(reference))
+	defer func() { vipps.EndSpan(span, err) }()
+
+	endpoint := fmt.Sprintf("%s/%s/payments/%s", c.BaseURL, epaymentEndpoint, url.PathEscape(reference))
+	method := http.MethodGet
+	res := Payment{}
+
+	req, err := c.APIClient.NewRequest(ctx, method, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	internal.SetMerchant(req, c.merchant(ctx, ""))
+
+	err = c.APIClient.Do(req, &res)
+	if err != nil {
+		return nil, wrapErr(err)
+	}
+
+	return &res, nil
+}
+
+// GetPaymentEvents gets the event log of a Payment, oldest first.
+func (c *Client) GetPaymentEvents(ctx context.Context, reference string) (_ []*Event, err error) {
+	ctx, span := vipps.StartSpan(ctx, c.Tracer, vipps.SpanKindClient, "epayment.GetPaymentEvents", vipps.ReferenceAttr(reference))
+	defer func() { vipps.EndSpan(span, err) }()
+
+	endpoint := fmt.Sprintf("%s/%s/payments/%s/events", c.BaseURL, epaymentEndpoint, url.PathEscape(reference))
+	method := http.MethodGet
+	res := make([]*Event, 0)
+
+	req, err := c.APIClient.NewRequest(ctx, method, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	internal.SetMerchant(req, c.merchant(ctx, ""))
+
+	err = c.APIClient.Do(req, &res)
+	if err != nil {
+		return nil, wrapErr(err)
+	}
+
+	return res, nil
+}
+
+// CapturePayment captures authorized amounts on a Payment.
+func (c *Client) CapturePayment(ctx context.Context, cmd CapturePaymentCommand) (_ *ModifiedPayment, err error) {
+	ctx, span := vipps.StartSpan(ctx, c.Tracer, vipps.SpanKindClient, "epayment.CapturePayment", vipps.ReferenceAttr(cmd.Reference))
+	defer func() { vipps.EndSpan(span, err) }()
+
+	cmd.MerchantSerialNumber = c.merchant(ctx, cmd.MerchantSerialNumber)
+	if err := c.validate(cmd); err != nil {
+		return nil, err
+	}
+	operation := fmt.Sprintf("epayment.CapturePayment/%s/%s/%d", cmd.MerchantSerialNumber, cmd.Reference, cmd.ModificationAmount.Minor)
+	return c.modifyPayment(ctx, "capture", operation, cmd.Reference, cmd.MerchantSerialNumber, cmd.IdempotencyKey, cmd)
+}
+
+// RefundPayment refunds captured amounts on a Payment.
+func (c *Client) RefundPayment(ctx context.Context, cmd RefundPaymentCommand) (_ *ModifiedPayment, err error) {
+	ctx, span := vipps.StartSpan(ctx, c.Tracer, vipps.SpanKindClient, "epayment.RefundPayment", vipps.ReferenceAttr(cmd.Reference))
+	defer func() { vipps.EndSpan(span, err) }()
+
+	cmd.MerchantSerialNumber = c.merchant(ctx, cmd.MerchantSerialNumber)
+	if err := c.validate(cmd); err != nil {
+		return nil, err
+	}
+	operation := fmt.Sprintf("epayment.RefundPayment/%s/%s/%d", cmd.MerchantSerialNumber, cmd.Reference, cmd.ModificationAmount.Minor)
+	return c.modifyPayment(ctx, "refund", operation, cmd.Reference, cmd.MerchantSerialNumber, cmd.IdempotencyKey, cmd)
+}
+
+// CancelPayment cancels a Payment. Errors for payments that are captured.
+func (c *Client) CancelPayment(ctx context.Context, cmd CancelPaymentCommand) (_ *ModifiedPayment, err error) {
+	ctx, span := vipps.StartSpan(ctx, c.Tracer, vipps.SpanKindClient, "epayment.CancelPayment", vipps.ReferenceAttr(cmd.Reference))
+	defer func() { vipps.EndSpan(span, err) }()
+
+	cmd.MerchantSerialNumber = c.merchant(ctx, cmd.MerchantSerialNumber)
+	if err := c.validate(cmd); err != nil {
+		return nil, err
+	}
+	operation := fmt.Sprintf("epayment.CancelPayment/%s/%s", cmd.MerchantSerialNumber, cmd.Reference)
+	return c.modifyPayment(ctx, "cancel", operation, cmd.Reference, cmd.MerchantSerialNumber, cmd.IdempotencyKey, struct{}{})
+}
+
+// modifyPayment sends cmd to the endpoint for op on the payment with
+// reference. operation identifies the modification in the IdempotencyStore.
+func (c *Client) modifyPayment(ctx context.Context, op, operation, reference, msn, idempotencyKey string, cmd interface{}) (*ModifiedPayment, error) {
+	key, done, err := internal.IdempotencyKey(ctx, internal.Logger(c.APIClient), c.IdempotencyStore, operation, idempotencyKey)
+	if err != nil {
+		return nil, err
+	}
+	endpoint := fmt.Sprintf("%s/%s/payments/%s/%s", c.BaseURL, epaymentEndpoint, url.PathEscape(reference), op)
+	method := http.MethodPost
+	res := ModifiedPayment{}
+
+	req, err := c.APIClient.NewRequest(ctx, method, endpoint, cmd)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Idempotency-Key", key)
+	internal.SetMerchant(req, msn)
+
+	err = c.APIClient.Do(req, &res)
+	done(err)
+	if err != nil {
+		return nil, wrapErr(err)
+	}
+	res.IdempotencyKey = key
+
+	return &res, nil
+}
+
+// ForceApprove approves a Payment on behalf of a test user, without the Vipps
+// app. Only available in the test environment.
+func (c *Client) ForceApprove(ctx context.Context, cmd ForceApproveCommand) (err error) {
+	ctx, span := vipps.StartSpan(ctx, c.Tracer, vipps.SpanKindClient, "epayment.ForceApprove", vipps.ReferenceAttr(cmd.Reference))
+	defer func() { vipps.EndSpan(span, err) }()
+
+	cmd.MerchantSerialNumber = c.merchant(ctx, cmd.MerchantSerialNumber)
+	if err := c.validate(cmd); err != nil {
+		return err
+	}
+	endpoint := fmt.Sprintf("%s/%s/test/payments/%s/approve", c.BaseURL, epaymentEndpoint, url.PathEscape(cmd.Reference))
+	method := http.MethodPost
+
+	req, err := c.APIClient.NewRequest(ctx, method, endpoint, cmd)
+	if err != nil {
+		return err
+	}
+	internal.SetMerchant(req, cmd.MerchantSerialNumber)
+
+	err = c.APIClient.Do(req, nil)
+	if err != nil {
+		return wrapErr(err)
+	}
+
+	return nil
+}
+
+// merchant returns msn, or else the serial number carried by ctx or
+// configured for c.
+func (c *Client) merchant(ctx context.Context, msn string) string {
+	return internal.ResolveMerchant(ctx, msn, c.MerchantSerialNumber)
+}
+
+// validator is implemented by commands that can be validated before they are
+// sent.
+type validator interface {
+	Validate() error
+}
+
+func (c *Client) validate(cmd validator) error {
+	if c.SkipValidation {
+		return nil
+	}
+	return cmd.Validate()
+}
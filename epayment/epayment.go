@@ -0,0 +1,193 @@
+// Package epayment provides a Client and supporting types to consume and
+// interact with the Vipps ePayment API v1.
+package epayment
+
+import (
+	"github.com/torfjor/go-vipps"
+	"time"
+)
+
+const epaymentEndpoint = "epayment/v1"
+
+// PaymentMethodType represents how the user pays.
+type PaymentMethodType string
+
+// List of values that PaymentMethodType can take.
+const (
+	PaymentMethodTypeWallet PaymentMethodType = "WALLET"
+	PaymentMethodTypeCard   PaymentMethodType = "CARD"
+)
+
+// PaymentMethod represents the method used for a payment.
+type PaymentMethod struct {
+	Type PaymentMethodType `json:"type"`
+	// CardBin is the bank identification number of the card used, if any.
+	// Only set on Payments returned by Vipps.
+	CardBin string `json:"cardBin,omitempty"`
+}
+
+// UserFlow represents how the user is brought to the Vipps app to complete a
+// payment.
+type UserFlow string
+
+// List of values that UserFlow can take.
+const (
+	// UserFlowPushMessage sends a push notification to the user's phone
+	// number directly.
+	UserFlowPushMessage UserFlow = "PUSH_MESSAGE"
+	// UserFlowWebRedirect redirects the user to a Vipps landing page.
+	UserFlowWebRedirect UserFlow = "WEB_REDIRECT"
+	// UserFlowQR returns a QR code for the user to scan.
+	UserFlowQR UserFlow = "QR"
+	// UserFlowNativeRedirect returns a deep link to the Vipps app, for
+	// payments initiated from a mobile app.
+	UserFlowNativeRedirect UserFlow = "NATIVE_REDIRECT"
+)
+
+// Customer identifies the user that pays.
+type Customer struct {
+	// PhoneNumber is the user's phone number, with country code and no `+`
+	// prefix, e.g. `4791234567`.
+	PhoneNumber string `json:"phoneNumber,omitempty"`
+}
+
+// CreatePaymentCommand represents the command used to create a Payment.
+type CreatePaymentCommand struct {
+	// IdempotencyKey, if empty, is generated by the Client.
+	IdempotencyKey       string        `json:"-"`
+	MerchantSerialNumber string        `json:"-"`
+	Amount               vipps.Money   `json:"amount"`
+	Customer             *Customer     `json:"customer,omitempty"`
+	PaymentMethod        PaymentMethod `json:"paymentMethod"`
+	// Reference uniquely identifies the payment for the sales unit. Must be
+	// between 8 and 50 characters from `a-z A-Z 0-9 -`.
+	Reference string `json:"reference"`
+	// ReturnURL is where the user is sent after completing the payment flow.
+	// Required for every UserFlow but PUSH_MESSAGE and QR.
+	ReturnURL          string   `json:"returnUrl,omitempty"`
+	UserFlow           UserFlow `json:"userFlow"`
+	PaymentDescription string   `json:"paymentDescription,omitempty"`
+}
+
+// PaymentReference represents a reference to a created Payment, and where the
+// user can continue the payment flow.
+type PaymentReference struct {
+	RedirectURL string `json:"redirectUrl"`
+	Reference   string `json:"reference"`
+	// IdempotencyKey is the key that the request was sent with.
+	IdempotencyKey string `json:"-"`
+}
+
+// State is the current state of a Payment.
+type State string
+
+// List of values that State can take.
+const (
+	StateCreated    State = "CREATED"
+	StateAborted    State = "ABORTED"
+	StateExpired    State = "EXPIRED"
+	StateAuthorized State = "AUTHORIZED"
+	StateTerminated State = "TERMINATED"
+)
+
+// Aggregate represents the sums of the operations done on a Payment.
+type Aggregate struct {
+	AuthorizedAmount vipps.Money `json:"authorizedAmount"`
+	CancelledAmount  vipps.Money `json:"cancelledAmount"`
+	CapturedAmount   vipps.Money `json:"capturedAmount"`
+	RefundedAmount   vipps.Money `json:"refundedAmount"`
+}
+
+// Profile represents the user information shared with the merchant.
+type Profile struct {
+	Sub string `json:"sub"`
+}
+
+// Payment represents a Vipps ePayment payment.
+type Payment struct {
+	Aggregate     Aggregate     `json:"aggregate"`
+	Amount        vipps.Money   `json:"amount"`
+	State         State         `json:"state"`
+	PaymentMethod PaymentMethod `json:"paymentMethod"`
+	Profile       Profile       `json:"profile"`
+	PSPReference  string        `json:"pspReference"`
+	RedirectURL   string        `json:"redirectUrl"`
+	Reference     string        `json:"reference"`
+}
+
+// EventName is the name of an operation on a Payment.
+type EventName string
+
+// List of values that EventName can take.
+const (
+	EventNameCreated    EventName = "CREATED"
+	EventNameAborted    EventName = "ABORTED"
+	EventNameExpired    EventName = "EXPIRED"
+	EventNameCancelled  EventName = "CANCELLED"
+	EventNameCaptured   EventName = "CAPTURED"
+	EventNameRefunded   EventName = "REFUNDED"
+	EventNameAuthorized EventName = "AUTHORIZED"
+	EventNameTerminated EventName = "TERMINATED"
+)
+
+// Event represents an entry in the event log of a Payment.
+type Event struct {
+	Reference      string      `json:"reference"`
+	PSPReference   string      `json:"pspReference"`
+	Name           EventName   `json:"name"`
+	Amount         vipps.Money `json:"amount"`
+	Timestamp      time.Time   `json:"timestamp"`
+	IdempotencyKey string      `json:"idempotencyKey"`
+	Success        bool        `json:"success"`
+}
+
+// CapturePaymentCommand represents the command used to capture an authorized
+// Payment, in full or in part.
+type CapturePaymentCommand struct {
+	// IdempotencyKey, if empty, is generated by the Client.
+	IdempotencyKey       string      `json:"-"`
+	MerchantSerialNumber string      `json:"-"`
+	Reference            string      `json:"-"`
+	ModificationAmount   vipps.Money `json:"modificationAmount"`
+}
+
+// RefundPaymentCommand represents the command used to refund a captured
+// Payment, in full or in part.
+type RefundPaymentCommand struct {
+	// IdempotencyKey, if empty, is generated by the Client.
+	IdempotencyKey       string      `json:"-"`
+	MerchantSerialNumber string      `json:"-"`
+	Reference            string      `json:"-"`
+	ModificationAmount   vipps.Money `json:"modificationAmount"`
+}
+
+// CancelPaymentCommand represents the command used to cancel a Payment that
+// is not captured.
+type CancelPaymentCommand struct {
+	// IdempotencyKey, if empty, is generated by the Client.
+	IdempotencyKey       string
+	MerchantSerialNumber string
+	Reference            string
+}
+
+// ModifiedPayment represents a Payment after a capture, refund or cancel.
+type ModifiedPayment struct {
+	Aggregate    Aggregate   `json:"aggregate"`
+	Amount       vipps.Money `json:"amount"`
+	State        State       `json:"state"`
+	PSPReference string      `json:"pspReference"`
+	Reference    string      `json:"reference"`
+	// IdempotencyKey is the key that the request was sent with.
+	IdempotencyKey string `json:"-"`
+}
+
+// ForceApproveCommand represents the command used to approve a Payment on
+// behalf of a test user, without the Vipps app.
+type ForceApproveCommand struct {
+	MerchantSerialNumber string   `json:"-"`
+	Reference            string   `json:"-"`
+	Customer             Customer `json:"customer"`
+	// Token is the token of the payment's landing page, for payments with
+	// the WEB_REDIRECT flow.
+	Token string `json:"token,omitempty"`
+}
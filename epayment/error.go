@@ -0,0 +1,40 @@
+package epayment
+
+import (
+	"github.com/torfjor/go-vipps"
+	"github.com/torfjor/go-vipps/internal"
+)
+
+// ErrEPayment represents an error returned from the Vipps ePayment API, in the
+// problem details format of RFC 7807.
+type ErrEPayment struct {
+	internal.Problem
+}
+
+// FieldError represents a problem with a single field of a request.
+type FieldError = internal.ProblemField
+
+// errorKinds maps the problem types documented for the ePayment API, at
+// https://developer.vippsmobilepay.com/docs/APIs/epayment-api/problems, to the
+// errors they are classified as.
+var errorKinds = map[string]error{
+	"payment-not-found":       vipps.ErrNotFound,
+	"already-captured":        vipps.ErrAlreadyCaptured,
+	"capture-amount-too-high": vipps.ErrInsufficientReservedAmount,
+	"refund-amount-too-high":  vipps.ErrInsufficientReservedAmount,
+}
+
+func wrapErr(err error) error {
+	if err, ok := err.(internal.HTTPError); ok {
+		problem, ok := internal.ParseProblem(err.Body)
+		if !ok {
+			return vipps.NewAPIError(err.Status, err.RequestID, nil, vipps.ErrUnexpectedResponse{
+				Body:      err.Body,
+				Status:    err.Status,
+				HTTPError: err,
+			})
+		}
+		return vipps.NewAPIError(err.Status, err.RequestID, errorKinds[problem.Code()], ErrEPayment{problem})
+	}
+	return err
+}
@@ -0,0 +1,93 @@
+package epayment
+
+import (
+	"github.com/torfjor/go-vipps"
+	"github.com/torfjor/go-vipps/internal"
+	"regexp"
+	"strconv"
+)
+
+// maxPaymentDescriptionLength is the maximum length of a payment description.
+const maxPaymentDescriptionLength = 100
+
+var (
+	referencePattern   = regexp.MustCompile(`^[a-zA-Z0-9-]{8,50}$`)
+	phoneNumberPattern = regexp.MustCompile(`^[0-9]{10,15}$`)
+)
+
+// Validate checks cmd against the rules documented for the ePayment API. It
+// returns a *vipps.ValidationError listing every invalid field.
+func (cmd CreatePaymentCommand) Validate() error {
+	var e vipps.ValidationError
+	e.Check(cmd.Amount.Minor > 0, "amount.value", "must be positive")
+	checkReference(&e, cmd.Reference)
+	switch cmd.PaymentMethod.Type {
+	case PaymentMethodTypeWallet, PaymentMethodTypeCard:
+	default:
+		e.Add("paymentMethod.type", "must be WALLET or CARD")
+	}
+	switch cmd.UserFlow {
+	case UserFlowPushMessage:
+		e.Check(cmd.Customer != nil && cmd.Customer.PhoneNumber != "", "customer.phoneNumber", "is required for PUSH_MESSAGE")
+	case UserFlowQR:
+	case UserFlowWebRedirect:
+		e.Check(internal.IsHTTPS(cmd.ReturnURL), "returnUrl", "must be an https URL")
+	case UserFlowNativeRedirect:
+		e.Check(cmd.ReturnURL != "", "returnUrl", "is required")
+	default:
+		e.Add("userFlow", "must be PUSH_MESSAGE, WEB_REDIRECT, QR or NATIVE_REDIRECT")
+	}
+	if c := cmd.Customer; c != nil && c.PhoneNumber != "" {
+		checkPhoneNumber(&e, c.PhoneNumber)
+	}
+	e.Check(internal.MaxLength(cmd.PaymentDescription, maxPaymentDescriptionLength), "paymentDescription",
+		"must be at most "+strconv.Itoa(maxPaymentDescriptionLength)+" characters")
+	return e.Err()
+}
+
+// Validate checks cmd against the rules documented for the ePayment API. It
+// returns a *vipps.ValidationError listing every invalid field.
+func (cmd CapturePaymentCommand) Validate() error {
+	var e vipps.ValidationError
+	checkReference(&e, cmd.Reference)
+	e.Check(cmd.ModificationAmount.Minor > 0, "modificationAmount.value", "must be positive")
+	return e.Err()
+}
+
+// Validate checks cmd against the rules documented for the ePayment API. It
+// returns a *vipps.ValidationError listing every invalid field.
+func (cmd RefundPaymentCommand) Validate() error {
+	var e vipps.ValidationError
+	checkReference(&e, cmd.Reference)
+	e.Check(cmd.ModificationAmount.Minor > 0, "modificationAmount.value", "must be positive")
+	return e.Err()
+}
+
+// Validate checks cmd against the rules documented for the ePayment API. It
+// returns a *vipps.ValidationError listing every invalid field.
+func (cmd CancelPaymentCommand) Validate() error {
+	var e vipps.ValidationError
+	checkReference(&e, cmd.Reference)
+	return e.Err()
+}
+
+// Validate checks cmd against the rules documented for the ePayment API. It
+// returns a *vipps.ValidationError listing every invalid field.
+func (cmd ForceApproveCommand) Validate() error {
+	var e vipps.ValidationError
+	checkReference(&e, cmd.Reference)
+	e.Check(cmd.Customer.PhoneNumber != "", "customer.phoneNumber", "is required")
+	if n := cmd.Customer.PhoneNumber; n != "" {
+		checkPhoneNumber(&e, n)
+	}
+	return e.Err()
+}
+
+func checkReference(e *vipps.ValidationError, reference string) {
+	e.Check(referencePattern.MatchString(reference), "reference", "must be 8 to 50 characters a-z, A-Z, 0-9 or -")
+}
+
+func checkPhoneNumber(e *vipps.ValidationError, n string) {
+	e.Check(phoneNumberPattern.MatchString(n), "customer.phoneNumber",
+		"must be a phone number with country code and no +, e.g. 4791234567")
+}
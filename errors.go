@@ -0,0 +1,81 @@
+package vipps
+
+import (
+	"errors"
+	"net/http"
+)
+
+// Errors that responses from the Vipps APIs are classified as. Use errors.Is
+// to test for them:
+//
+//	_, err := client.CapturePayment(ctx, cmd)
+//	if errors.Is(err, vipps.ErrAlreadyCaptured) {
+//		// Nothing left to capture
+//	}
+var (
+	ErrNotFound                   = errors.New("vipps: not found")
+	ErrUnauthorized               = errors.New("vipps: unauthorized")
+	ErrRateLimited                = errors.New("vipps: rate limited")
+	ErrAlreadyCaptured            = errors.New("vipps: already captured")
+	ErrInsufficientReservedAmount = errors.New("vipps: insufficient reserved amount")
+	ErrAgreementNotActive         = errors.New("vipps: agreement not active")
+	ErrChargeNotCancellable       = errors.New("vipps: charge not cancellable")
+)
+
+// APIError is an erroneous response from the Vipps APIs. It wraps the error
+// specific to the API, e.g. ecom.ErrEcom, so that it can be retrieved with
+// errors.As, and matches the error it is classified as with errors.Is.
+type APIError struct {
+	// Status is the HTTP status code of the response.
+	Status int
+	// RequestID identifies the request, as sent in the `X-Request-ID` or
+	// `Idempotency-Key` header, or as returned by Vipps.
+	RequestID string
+	// Kind is the error that the response is classified as, e.g.
+	// ErrNotFound, or nil if it is not classified.
+	Kind error
+	// Err is the error specific to the API.
+	Err error
+}
+
+// NewAPIError returns an APIError for a response with the given status,
+// wrapping err. If kind is nil, the response is classified by its status
+// alone.
+func NewAPIError(status int, requestID string, kind, err error) *APIError {
+	if kind == nil {
+		kind = kindOf(status)
+	}
+	return &APIError{Status: status, RequestID: requestID, Kind: kind, Err: err}
+}
+
+func (e *APIError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the error specific to the API.
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is the error that e is classified as.
+func (e *APIError) Is(target error) bool {
+	return e.Kind != nil && e.Kind == target
+}
+
+// Retryable reports whether the request may succeed if it is retried as is:
+// it was rate limited or failed with a server error.
+func (e *APIError) Retryable() bool {
+	return e.Status == http.StatusTooManyRequests || e.Status >= http.StatusInternalServerError
+}
+
+func kindOf(status int) error {
+	switch status {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return ErrUnauthorized
+	case http.StatusNotFound:
+		return ErrNotFound
+	case http.StatusTooManyRequests:
+		return ErrRateLimited
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package vipps
+
+import (
+	"context"
+	"github.com/torfjor/go-vipps/internal"
+	"sync"
+)
+
+// IdempotencyStore remembers the idempotency key used for a logical
+// operation, e.g. capturing an amount on an order, until Vipps has given a
+// definitive answer to it. A crashed process that retries the operation then
+// reuses the key, and Vipps does not perform it twice. A store shared by
+// processes, e.g. in the database of the application, must be persistent for
+// this to hold across restarts.
+//
+// Clients use the store for commands that are not given an idempotency key.
+// Operations are identified by strings like
+// `ecom.CapturePayment/123456/order-1/1000`, and are safe to use as keys as is.
+type IdempotencyStore interface {
+	// Key returns the key stored for operation, or "" if there is none.
+	Key(ctx context.Context, operation string) (string, error)
+	// SetKey stores key for operation.
+	SetKey(ctx context.Context, operation, key string) error
+	// DeleteKey forgets the key stored for operation, if any.
+	DeleteKey(ctx context.Context, operation string) error
+}
+
+// NewIdempotencyKey returns a new random idempotency key. Clients generate one
+// for commands that have none.
+func NewIdempotencyKey() string {
+	return internal.NewIdempotencyKey()
+}
+
+// MemoryIdempotencyStore is an IdempotencyStore that keeps keys in memory. It
+// makes retries within a process reuse keys, but does not survive restarts.
+type MemoryIdempotencyStore struct {
+	mu   sync.Mutex
+	keys map[string]string
+}
+
+// NewMemoryIdempotencyStore returns a new MemoryIdempotencyStore.
+func NewMemoryIdempotencyStore() *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{keys: make(map[string]string)}
+}
+
+// Key satisfies IdempotencyStore.
+func (s *MemoryIdempotencyStore) Key(ctx context.Context, operation string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.keys[operation], nil
+}
+
+// SetKey satisfies IdempotencyStore.
+func (s *MemoryIdempotencyStore) SetKey(ctx context.Context, operation, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.keys[operation] = key
+	return nil
+}
+
+// DeleteKey satisfies IdempotencyStore.
+func (s *MemoryIdempotencyStore) DeleteKey(ctx context.Context, operation string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.keys, operation)
+	return nil
+}
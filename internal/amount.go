@@ -0,0 +1,8 @@
+package internal
+
+// Amount is how the ePayment and Webhooks APIs represent an amount of money:
+// an object with the currency and the value in minor units.
+type Amount struct {
+	Currency string `json:"currency"`
+	Value    int64  `json:"value"`
+}
@@ -12,17 +12,28 @@ import (
 )
 
 type HTTPError struct {
-	Body   []byte
-	Status int
+	Body      []byte
+	Status    int
+	Header    http.Header
+	RequestID string
 }
 
 func (e HTTPError) Error() string {
 	return fmt.Sprintf("request failed with status: %d", e.Status)
 }
 
+// Doer sends HTTP requests. It is satisfied by *http.Client and vipps.Doer.
+type Doer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
 type APIClient struct {
 	L log.Logger
-	C *http.Client
+	C Doer
+	R *RetryPolicy
+	// H are headers sent with every request, unless the request or, for the
+	// Merchant-Serial-Number, its context sets them.
+	H http.Header
 }
 
 func (c *APIClient) NewRequest(ctx context.Context, method, endpoint string, body interface{}) (*http.Request, error) {
@@ -40,20 +51,33 @@ func (c *APIClient) NewRequest(ctx context.Context, method, endpoint string, bod
 }
 
 func (c *APIClient) Do(req *http.Request, v interface{}) error {
-	now := time.Now()
-	resp, err := c.C.Do(req)
+	setMerchant(req)
+	SetDefaultHeaders(req, c.H)
+	var (
+		body  []byte
+		err   error
+		start = time.Now()
+		retry = c.R.canRetry(req)
+	)
+	for attempt := 1; ; attempt++ {
+		var header http.Header
+		body, header, err = c.send(req, attempt)
+		if err == nil || !retry || !isRetryable(err) {
+			break
+		}
+		d, ok := c.R.wait(attempt, start, header)
+		if !ok {
+			break
+		}
+		c.L.Log("method", req.Method, "url", req.URL, "attempt", attempt, "retry_in", d, "err", err)
+		// A cancelled wait is reported as such, not as the failed attempt.
+		if err = sleep(req.Context(), d); err != nil {
+			break
+		}
+	}
 	if err != nil {
 		return err
 	}
-	c.L.Log("method", req.Method, "url", req.URL, "status", resp.StatusCode, "duration", time.Since(now))
-	defer resp.Body.Close()
-	body, _ := ioutil.ReadAll(resp.Body)
-	if resp.StatusCode < http.StatusOK || resp.StatusCode > 299 {
-		return HTTPError{
-			Body:   body,
-			Status: resp.StatusCode,
-		}
-	}
 	if v == nil {
 		return nil
 	}
@@ -63,3 +87,79 @@ func (c *APIClient) Do(req *http.Request, v interface{}) error {
 	}
 	return nil
 }
+
+// send performs a single attempt of req. Attempts after the first are made
+// with a fresh copy of the request body, and a context carrying the attempt
+// number.
+func (c *APIClient) send(req *http.Request, attempt int) ([]byte, http.Header, error) {
+	if attempt > 1 {
+		req = req.Clone(context.WithValue(req.Context(), attemptKey{}, attempt))
+		if req.GetBody != nil {
+			reqBody, err := req.GetBody()
+			if err != nil {
+				return nil, nil, err
+			}
+			req.Body = reqBody
+		}
+	}
+
+	resp, err := c.C.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode < http.StatusOK || resp.StatusCode > 299 {
+		return nil, resp.Header, HTTPError{
+			Body:      body,
+			Status:    resp.StatusCode,
+			Header:    resp.Header,
+			RequestID: requestID(req, resp),
+		}
+	}
+	return body, resp.Header, nil
+}
+
+// Logger returns the Logger of d, if it is an *APIClient, or else nil.
+func Logger(d interface{}) log.Logger {
+	if c, ok := d.(*APIClient); ok {
+		return c.L
+	}
+	return nil
+}
+
+// SetDefaultHeaders sets the headers in h on req, unless req sets them to a
+// non-empty value.
+func SetDefaultHeaders(req *http.Request, h http.Header) {
+	for k, v := range h {
+		if req.Header.Get(k) == "" {
+			req.Header[k] = v
+		}
+	}
+}
+
+type attemptKey struct{}
+
+// Attempt returns the number of the attempt that a request with ctx is, for
+// requests sent by APIClient. The first attempt is number 1.
+func Attempt(ctx context.Context) int {
+	if n, ok := ctx.Value(attemptKey{}).(int); ok {
+		return n
+	}
+	return 1
+}
+
+// requestID returns the id that the request was sent with, or else the id
+// that Vipps returned for it.
+func requestID(req *http.Request, resp *http.Response) string {
+	for _, id := range []string{
+		req.Header.Get("X-Request-ID"),
+		req.Header.Get("Idempotency-Key"),
+		resp.Header.Get("X-Request-ID"),
+	} {
+		if id != "" {
+			return id
+		}
+	}
+	return ""
+}
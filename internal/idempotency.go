@@ -0,0 +1,81 @@
+package internal
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-kit/kit/log"
+	"time"
+)
+
+// deleteKeyTimeout bounds the time spent making a store forget a key. The
+// delete does not use the context of the operation, which may be done.
+const deleteKeyTimeout = 5 * time.Second
+
+// IdempotencyStore is satisfied by vipps.IdempotencyStore.
+type IdempotencyStore interface {
+	Key(ctx context.Context, operation string) (string, error)
+	SetKey(ctx context.Context, operation, key string) error
+	DeleteKey(ctx context.Context, operation string) error
+}
+
+// NewIdempotencyKey returns a random version 4 UUID.
+func NewIdempotencyKey() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// IdempotencyKey returns key, if set, or else the key that store remembers for
+// operation, or else a new key that store is made to remember. store may be
+// nil. The returned func must be called with the outcome of the operation: it
+// makes store forget the key once Vipps has given a definitive answer, i.e.
+// not after transport errors, cancellations, or 5xx and 429 responses, after
+// which the operation should be retried with the same key. Failures to forget
+// the key are logged to logger, which may be nil.
+func IdempotencyKey(ctx context.Context, logger log.Logger, store IdempotencyStore, operation, key string) (string, func(err error), error) {
+	done := func(error) {}
+	if key != "" {
+		return key, done, nil
+	}
+	if store == nil {
+		return NewIdempotencyKey(), done, nil
+	}
+
+	key, err := store.Key(ctx, operation)
+	if err != nil {
+		return "", nil, err
+	}
+	if key == "" {
+		key = NewIdempotencyKey()
+		if err := store.SetKey(ctx, operation, key); err != nil {
+			return "", nil, err
+		}
+	}
+	return key, func(err error) {
+		var httpErr HTTPError
+		if err == nil || errors.As(err, &httpErr) && !isRetryable(httpErr) {
+			ctx, cancel := context.WithTimeout(context.Background(), deleteKeyTimeout)
+			defer cancel()
+			if err := store.DeleteKey(ctx, operation); err != nil && logger != nil {
+				logger.Log("msg", "failed to delete idempotency key", "operation", operation, "err", err)
+			}
+		}
+	}, nil
+}
+
+// Fingerprint returns a short hash of the JSON encoding of v, to tell
+// operations on the same resource apart by their content.
+func Fingerprint(v interface{}) string {
+	b, _ := json.Marshal(v)
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:8])
+}
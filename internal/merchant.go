@@ -0,0 +1,53 @@
+package internal
+
+import (
+	"context"
+	"net/http"
+)
+
+// HeaderMerchantSerialNumber identifies the sales unit that a request is made
+// on behalf of.
+const HeaderMerchantSerialNumber = "Merchant-Serial-Number"
+
+type merchantKey struct{}
+
+// ContextWithMerchant returns a copy of ctx carrying msn.
+func ContextWithMerchant(ctx context.Context, msn string) context.Context {
+	return context.WithValue(ctx, merchantKey{}, msn)
+}
+
+// MerchantFromContext returns the msn carried by ctx, or "" if none.
+func MerchantFromContext(ctx context.Context) string {
+	msn, _ := ctx.Value(merchantKey{}).(string)
+	return msn
+}
+
+// setMerchant sets the Merchant-Serial-Number header of req to the msn
+// carried by its context, unless req sets it.
+func setMerchant(req *http.Request) {
+	if req.Header.Get(HeaderMerchantSerialNumber) != "" {
+		return
+	}
+	if msn := MerchantFromContext(req.Context()); msn != "" {
+		req.Header.Set(HeaderMerchantSerialNumber, msn)
+	}
+}
+
+// ResolveMerchant returns msn, or else the msn carried by ctx, or else def.
+func ResolveMerchant(ctx context.Context, msn, def string) string {
+	if msn != "" {
+		return msn
+	}
+	if msn := MerchantFromContext(ctx); msn != "" {
+		return msn
+	}
+	return def
+}
+
+// SetMerchant sets the Merchant-Serial-Number header of req to msn, unless msn
+// is empty.
+func SetMerchant(req *http.Request, msn string) {
+	if msn != "" {
+		req.Header.Set(HeaderMerchantSerialNumber, msn)
+	}
+}
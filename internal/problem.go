@@ -0,0 +1,94 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// Problem is an error returned in the problem details format of RFC 7807, as
+// by the Recurring v3, ePayment and Webhooks APIs.
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail"`
+	Instance string `json:"instance"`
+	// ContextID identifies the request in the Recurring API.
+	ContextID string `json:"contextId,omitempty"`
+	// TraceID identifies the request in the ePayment and Webhooks APIs.
+	TraceID      string         `json:"traceId,omitempty"`
+	ExtraDetails []ProblemField `json:"extraDetails"`
+}
+
+// ProblemField represents a problem with a single field of a request.
+type ProblemField struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// UnmarshalJSON satisfies json.Unmarshaler. The Recurring API calls Name and
+// Reason `field` and `text`.
+func (f *ProblemField) UnmarshalJSON(b []byte) error {
+	var v struct {
+		Name   string `json:"name"`
+		Reason string `json:"reason"`
+		Field  string `json:"field"`
+		Text   string `json:"text"`
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	f.Name, f.Reason = v.Name, v.Reason
+	if f.Name == "" {
+		f.Name = v.Field
+	}
+	if f.Reason == "" {
+		f.Reason = v.Text
+	}
+	return nil
+}
+
+// ParseProblem parses body as a Problem, and reports whether it is one.
+func ParseProblem(body []byte) (Problem, bool) {
+	var p Problem
+	if err := json.Unmarshal(body, &p); err != nil || (p.Title == "" && p.Detail == "") {
+		return Problem{}, false
+	}
+	return p, true
+}
+
+func (p Problem) Error() string {
+	s := []string{fmt.Sprintf("vipps: %s: %s", p.Title, p.Detail)}
+	for _, f := range p.ExtraDetails {
+		s = append(s, fmt.Sprintf("field %s: %s", f.Name, f.Reason))
+	}
+	return strings.Join(s, ", ")
+}
+
+// Code returns the code of the problem: the fragment of its Type URI, or else
+// the last segment of its path, e.g. `charge-not-found` for
+// `https://developer.vippsmobilepay.com/docs/APIs/recurring-api/recurring-api-problems#charge-not-found`.
+func (p Problem) Code() string {
+	u, err := url.Parse(p.Type)
+	if err != nil || p.Type == "" || p.Type == "about:blank" {
+		return ""
+	}
+	if u.Fragment != "" {
+		return u.Fragment
+	}
+	if base := path.Base(u.Path); base != "." && base != "/" {
+		return base
+	}
+	return ""
+}
+
+// ErrorCodes returns the code of p, if any.
+func (p Problem) ErrorCodes() []string {
+	if code := p.Code(); code != "" {
+		return []string{code}
+	}
+	return nil
+}
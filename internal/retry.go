@@ -0,0 +1,121 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Headers carrying idempotency keys in the Vipps APIs. Mutating requests are
+// only retried when one of them is set.
+const (
+	headerIdempotencyKey = "Idempotency-Key"
+	headerRequestID      = "X-Request-ID"
+)
+
+// RetryPolicy controls if and how failed requests are retried by APIClient.
+type RetryPolicy struct {
+	MaxAttempts int
+	MinBackoff  time.Duration
+	MaxBackoff  time.Duration
+	MaxElapsed  time.Duration
+}
+
+// canRetry reports whether req may be sent more than once under the policy.
+func (p *RetryPolicy) canRetry(req *http.Request) bool {
+	if p == nil || p.MaxAttempts < 2 {
+		return false
+	}
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return req.Header.Get(headerIdempotencyKey) != "" || req.Header.Get(headerRequestID) != ""
+}
+
+// wait returns how long to wait before attempt number attempt+1, and whether
+// another attempt should be made at all.
+func (p *RetryPolicy) wait(attempt int, start time.Time, header http.Header) (time.Duration, bool) {
+	if attempt >= p.MaxAttempts {
+		return 0, false
+	}
+
+	d, ok := retryAfter(header)
+	if !ok {
+		d = p.backoff(attempt)
+	}
+
+	if p.MaxElapsed > 0 && time.Since(start)+d > p.MaxElapsed {
+		return 0, false
+	}
+	return d, true
+}
+
+// backoff returns an exponential backoff with jitter for the given attempt.
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	min, max := p.MinBackoff, p.MaxBackoff
+	if min <= 0 {
+		min = 100 * time.Millisecond
+	}
+	if max < min {
+		max = min
+	}
+
+	d := min
+	for i := 1; i < attempt && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// retryAfter parses the Retry-After header, which is either a number of
+// seconds or an HTTP date.
+func retryAfter(header http.Header) (time.Duration, bool) {
+	v := header.Get("Retry-After")
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		d := time.Until(t)
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+	return 0, false
+}
+
+// isRetryable reports whether err is a transient failure worth retrying.
+func isRetryable(err error) bool {
+	var httpErr HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.Status == http.StatusTooManyRequests || httpErr.Status >= http.StatusInternalServerError
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	return true
+}
+
+// sleep waits for d or until ctx is done, whichever comes first.
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
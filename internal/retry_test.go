@@ -0,0 +1,213 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"github.com/go-kit/kit/log"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   RetryPolicy
+		attempt  int
+		min, max time.Duration
+	}{
+		{"first", RetryPolicy{MinBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}, 1, 50 * time.Millisecond, 100 * time.Millisecond},
+		{"doubles", RetryPolicy{MinBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}, 3, 200 * time.Millisecond, 400 * time.Millisecond},
+		{"capped", RetryPolicy{MinBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}, 10, 500 * time.Millisecond, time.Second},
+		{"default min", RetryPolicy{}, 1, 50 * time.Millisecond, 100 * time.Millisecond},
+		{"max below min", RetryPolicy{MinBackoff: time.Second, MaxBackoff: time.Millisecond}, 5, 500 * time.Millisecond, time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := 0; i < 100; i++ {
+				if d := tt.policy.backoff(tt.attempt); d < tt.min || d > tt.max {
+					t.Fatalf("backoff(%d) = %v, want in [%v, %v]", tt.attempt, d, tt.min, tt.max)
+				}
+			}
+		})
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		name   string
+		value  string
+		want   time.Duration
+		wantOK bool
+	}{
+		{"absent", "", 0, false},
+		{"seconds", "3", 3 * time.Second, true},
+		{"zero", "0", 0, true},
+		{"negative", "-1", 0, false},
+		{"past date", "Mon, 02 Jan 2006 15:04:05 GMT", 0, true},
+		{"garbage", "soon", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := http.Header{}
+			if tt.value != "" {
+				h.Set("Retry-After", tt.value)
+			}
+			got, ok := retryAfter(h)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("retryAfter(%q) = %v, %v, want %v, %v", tt.value, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+
+	t.Run("future date", func(t *testing.T) {
+		h := http.Header{}
+		h.Set("Retry-After", time.Now().Add(time.Minute).UTC().Format(http.TimeFormat))
+		got, ok := retryAfter(h)
+		if !ok || got <= 50*time.Second || got > time.Minute {
+			t.Errorf("retryAfter = %v, %v, want about a minute", got, ok)
+		}
+	})
+}
+
+func TestRetryPolicyWait(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 3, MinBackoff: time.Millisecond, MaxBackoff: time.Millisecond, MaxElapsed: time.Minute}
+	retryIn := func(v string) http.Header {
+		return http.Header{"Retry-After": []string{v}}
+	}
+	tests := []struct {
+		name    string
+		attempt int
+		start   time.Time
+		header  http.Header
+		want    time.Duration
+		wantOK  bool
+	}{
+		{"retry after", 1, time.Now(), retryIn("2"), 2 * time.Second, true},
+		{"attempts exhausted", 3, time.Now(), nil, 0, false},
+		{"over budget", 1, time.Now(), retryIn("120"), 0, false},
+		{"budget spent", 1, time.Now().Add(-time.Minute), nil, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := policy.wait(tt.attempt, tt.start, tt.header)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("wait = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestCanRetry(t *testing.T) {
+	policy := &RetryPolicy{MaxAttempts: 2}
+	tests := []struct {
+		name   string
+		policy *RetryPolicy
+		method string
+		header string
+		want   bool
+	}{
+		{"nil policy", nil, http.MethodGet, "", false},
+		{"single attempt", &RetryPolicy{MaxAttempts: 1}, http.MethodGet, "", false},
+		{"get", policy, http.MethodGet, "", true},
+		{"post", policy, http.MethodPost, "", false},
+		{"post with idempotency key", policy, http.MethodPost, headerIdempotencyKey, true},
+		{"post with request id", policy, http.MethodPost, headerRequestID, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tt.method, "https://example.com", nil)
+			if tt.header != "" {
+				req.Header.Set(tt.header, "key")
+			}
+			if got := tt.policy.canRetry(req); got != tt.want {
+				t.Errorf("canRetry = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// doerFunc is a Doer that calls itself for every request.
+type doerFunc func(req *http.Request) (*http.Response, error)
+
+func (f doerFunc) Do(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func respond(status int, header http.Header) doerFunc {
+	return func(req *http.Request) (*http.Response, error) {
+		if header == nil {
+			header = http.Header{}
+		}
+		return &http.Response{
+			StatusCode: status,
+			Header:     header,
+			Body:       ioutil.NopCloser(strings.NewReader("{}")),
+		}, nil
+	}
+}
+
+func TestDoRetries(t *testing.T) {
+	policy := &RetryPolicy{MaxAttempts: 3, MinBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+	tests := []struct {
+		name         string
+		method       string
+		statuses     []int
+		wantAttempts int
+		wantStatus   int
+	}{
+		{"success", http.MethodGet, []int{200}, 1, 0},
+		{"recovers", http.MethodGet, []int{503, 200}, 2, 0},
+		{"exhausted", http.MethodGet, []int{503, 503, 503}, 3, 503},
+		{"too many requests", http.MethodGet, []int{429, 200}, 2, 0},
+		{"client error", http.MethodGet, []int{400}, 1, 400},
+		{"post without key", http.MethodPost, []int{503}, 1, 503},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts int
+			c := &APIClient{
+				L: log.NewNopLogger(),
+				R: policy,
+				C: doerFunc(func(req *http.Request) (*http.Response, error) {
+					if got := Attempt(req.Context()); got != attempts+1 {
+						t.Errorf("Attempt = %d, want %d", got, attempts+1)
+					}
+					status := tt.statuses[attempts]
+					attempts++
+					return respond(status, nil)(req)
+				}),
+			}
+			req, _ := c.NewRequest(context.Background(), tt.method, "https://example.com", nil)
+			err := c.Do(req, nil)
+			if attempts != tt.wantAttempts {
+				t.Errorf("attempts = %d, want %d", attempts, tt.wantAttempts)
+			}
+			var httpErr HTTPError
+			switch {
+			case tt.wantStatus == 0 && err != nil:
+				t.Errorf("Do = %v, want nil", err)
+			case tt.wantStatus != 0 && (!errors.As(err, &httpErr) || httpErr.Status != tt.wantStatus):
+				t.Errorf("Do = %v, want status %d", err, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestDoCancelledWait(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &APIClient{
+		L: log.NewNopLogger(),
+		R: &RetryPolicy{MaxAttempts: 3},
+		C: doerFunc(func(req *http.Request) (*http.Response, error) {
+			cancel()
+			return respond(http.StatusServiceUnavailable, http.Header{"Retry-After": []string{"60"}})(req)
+		}),
+	}
+	req, _ := c.NewRequest(ctx, http.MethodGet, "https://example.com", nil)
+	if err := c.Do(req, nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("Do = %v, want %v", err, context.Canceled)
+	}
+}
@@ -0,0 +1,125 @@
+package internal
+
+import (
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Limits documented for the Recurring API, shared by its v2 and v3 packages.
+const (
+	MaxProductNameLength        = 45
+	MaxProductDescriptionLength = 100
+	MaxChargeDescriptionLength  = 45
+	MaxIntervalCount            = 31
+	MaxRetryDays                = 14
+	// MinDueDays is the minimum number of days between creating a Charge and
+	// its due date.
+	MinDueDays = 2
+)
+
+// Checker collects the invalid fields of a command. It is satisfied by
+// *vipps.ValidationError.
+type Checker interface {
+	Add(field, reason string)
+	Check(ok bool, field, reason string)
+}
+
+var (
+	orderIDPattern      = regexp.MustCompile(`^[a-zA-Z0-9-]{1,50}$`)
+	mobileNumberPattern = regexp.MustCompile(`^[0-9]{8}$`)
+)
+
+// ValidOrderID reports whether s is a valid Vipps order ID: 1 to 50
+// characters a-z, A-Z, 0-9 and `-`.
+func ValidOrderID(s string) bool {
+	return orderIDPattern.MatchString(s)
+}
+
+// ValidMobileNumber reports whether s is an 8 digit Norwegian mobile number,
+// without country prefix.
+func ValidMobileNumber(s string) bool {
+	return mobileNumberPattern.MatchString(s)
+}
+
+// MaxLength reports whether s is at most n characters long.
+func MaxLength(s string, n int) bool {
+	return utf8.RuneCountInString(s) <= n
+}
+
+// IsHTTPS reports whether s is an absolute https URL.
+func IsHTTPS(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && u.Scheme == "https" && u.Host != ""
+}
+
+// DueAfter reports whether the date of due is at least days after the date of
+// now. Dates are compared as calendar dates, each in its own time zone.
+func DueAfter(due, now time.Time, days int) bool {
+	y, m, d := now.Date()
+	earliest := time.Date(y, m, d+days, 0, 0, 0, 0, time.UTC)
+	y, m, d = due.Date()
+	return !time.Date(y, m, d, 0, 0, 0, 0, time.UTC).Before(earliest)
+}
+
+// CheckOneOf checks that value is one of values.
+func CheckOneOf(c Checker, field, value string, values ...string) {
+	for _, v := range values {
+		if value == v {
+			return
+		}
+	}
+	reason := "must be " + values[0]
+	if n := len(values); n > 1 {
+		reason = "must be one of " + strings.Join(values[:n-1], ", ") + " or " + values[n-1]
+	}
+	c.Add(field, reason)
+}
+
+// CheckOrderID checks that orderID is empty or a valid order ID.
+func CheckOrderID(c Checker, field, orderID string) {
+	if orderID != "" {
+		c.Check(ValidOrderID(orderID), field, "must be 1 to 50 characters a-z, A-Z, 0-9 or -")
+	}
+}
+
+// CheckProduct checks the product name and description of a Recurring
+// agreement. The name may only be empty if it is not required.
+func CheckProduct(c Checker, name, description string, required bool) {
+	c.Check(!required || name != "", "productName", "is required")
+	c.Check(MaxLength(name, MaxProductNameLength), "productName",
+		"must be at most "+strconv.Itoa(MaxProductNameLength)+" characters")
+	c.Check(MaxLength(description, MaxProductDescriptionLength), "productDescription",
+		"must be at most "+strconv.Itoa(MaxProductDescriptionLength)+" characters")
+}
+
+// CheckChargeDescription checks the description of a Recurring charge.
+func CheckChargeDescription(c Checker, field, description string) {
+	c.Check(description != "", field, "is required")
+	c.Check(MaxLength(description, MaxChargeDescriptionLength), field,
+		"must be at most "+strconv.Itoa(MaxChargeDescriptionLength)+" characters")
+}
+
+// CheckIntervalCount checks the number of interval units between the charges
+// of a Recurring agreement.
+func CheckIntervalCount(c Checker, field string, count int) {
+	c.Check(count >= 1 && count <= MaxIntervalCount, field,
+		"must be between 1 and "+strconv.Itoa(MaxIntervalCount))
+}
+
+// CheckDue checks that a Recurring charge is due at least MinDueDays after
+// now.
+func CheckDue(c Checker, field string, due, now time.Time) {
+	c.Check(DueAfter(due, now, MinDueDays), field,
+		"must be at least "+strconv.Itoa(MinDueDays)+" days in the future")
+}
+
+// CheckRetryDays checks the number of days a failed Recurring charge is
+// retried.
+func CheckRetryDays(c Checker, field string, days int) {
+	c.Check(days >= 0 && days <= MaxRetryDays, field,
+		"must be between 0 and "+strconv.Itoa(MaxRetryDays))
+}
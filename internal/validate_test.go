@@ -0,0 +1,65 @@
+package internal
+
+import (
+	"testing"
+)
+
+// checks records the fields and reasons added to it.
+type checks map[string]string
+
+func (c checks) Add(field, reason string) {
+	c[field] = reason
+}
+
+func (c checks) Check(ok bool, field, reason string) {
+	if !ok {
+		c.Add(field, reason)
+	}
+}
+
+func TestCheckOneOf(t *testing.T) {
+	tests := []struct {
+		name   string
+		value  string
+		values []string
+		want   string
+	}{
+		{"valid", "B", []string{"A", "B"}, ""},
+		{"one", "B", []string{"A"}, "must be A"},
+		{"two", "C", []string{"A", "B"}, "must be one of A or B"},
+		{"three", "", []string{"A", "B", "C"}, "must be one of A, B or C"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := checks{}
+			CheckOneOf(c, "field", tt.value, tt.values...)
+			if got := c["field"]; got != tt.want {
+				t.Errorf("reason = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckProduct(t *testing.T) {
+	long := string(make([]rune, MaxProductNameLength+1))
+	tests := []struct {
+		name     string
+		product  string
+		required bool
+		want     string
+	}{
+		{"valid", "Product", true, ""},
+		{"missing", "", true, "is required"},
+		{"optional", "", false, ""},
+		{"too long", long, false, "must be at most 45 characters"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := checks{}
+			CheckProduct(c, tt.product, "", tt.required)
+			if got := c["productName"]; got != tt.want {
+				t.Errorf("reason = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
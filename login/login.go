@@ -6,7 +6,9 @@ import (
 	"errors"
 	"fmt"
 	"github.com/coreos/go-oidc"
+	"github.com/torfjor/go-vipps"
 	"golang.org/x/oauth2"
+	"net/http"
 	"time"
 )
 
@@ -47,6 +49,8 @@ type Provider struct {
 	provider    *oidc.Provider
 	oauthConfig oauth2.Config
 	verifier    *oidc.IDTokenVerifier
+	tracer      vipps.Tracer
+	store       AuthRequestStore
 }
 
 // ProviderConfig represents a configuration for a Provider
@@ -56,6 +60,12 @@ type ProviderConfig struct {
 	IssuerURL    IssuerURL
 	RedirectURL  string
 	Scopes       []string
+	// Tracer, if set, traces the discovery of the issuer and every code
+	// exchange.
+	Tracer vipps.Tracer
+	// Store keeps AuthRequests between RedirectToLogin and HandleRedirect,
+	// e.g. a CookieStore. They fail with ErrNoStore if it is nil.
+	Store AuthRequestStore
 }
 
 // Claims represents the claims contained in Vipps ID tokens
@@ -97,12 +107,22 @@ func (d *Date) String() string {
 	return fmt.Sprintf("%d-%d-%d", d.Day, d.Month, d.Year)
 }
 
+func (d Date) MarshalJSON() ([]byte, error) {
+	if d == (Date{}) {
+		return []byte("null"), nil
+	}
+	return []byte(fmt.Sprintf(`"%04d-%02d-%02d"`, d.Year, d.Month, d.Day)), nil
+}
+
 func (d *Date) UnmarshalJSON(bytes []byte) error {
 	var s, layout string
 	layout = "2006-01-02"
 	if err := json.Unmarshal(bytes, &s); err != nil {
 		return err
 	}
+	if s == "" {
+		return nil
+	}
 	t, err := time.Parse(layout, s)
 	if err != nil {
 		return err
@@ -118,7 +138,11 @@ func NewProvider(ctx context.Context, config *ProviderConfig) (*Provider, error)
 	if config.IssuerURL == "" {
 		config.IssuerURL = IssuerURLTesting
 	}
+	// The provider keeps ctx to fetch signing keys later, so it must not
+	// carry the span.
+	_, span := vipps.StartSpan(ctx, config.Tracer, vipps.SpanKindClient, "login.NewProvider")
 	provider, err := oidc.NewProvider(ctx, string(config.IssuerURL))
+	vipps.EndSpan(span, err)
 	if err != nil {
 		return nil, err
 	}
@@ -137,19 +161,100 @@ func NewProvider(ctx context.Context, config *ProviderConfig) (*Provider, error)
 		verifier: provider.Verifier(&oidc.Config{
 			ClientID: config.ClientID,
 		}),
+		tracer: config.Tracer,
+		store:  config.Store,
 	}, err
 }
 
 // AuthCodeURL returns a URL to OAuth 2.0 provider's consent page that asks for
-// permissions for the configured scopes explicitly
+// permissions for the configured scopes explicitly. It leaves state to the
+// caller, and uses neither a nonce nor PKCE; prefer NewAuthRequest.
 func (p *Provider) AuthCodeURL(state string) string {
 	return p.oauthConfig.AuthCodeURL(state)
 }
 
+// AuthError represents an error returned by Vipps in an authorization
+// response, e.g. when the user cancels the login.
+type AuthError struct {
+	Code        string
+	Description string
+}
+
+func (e *AuthError) Error() string {
+	if e.Description == "" {
+		return fmt.Sprintf("login: %s", e.Code)
+	}
+	return fmt.Sprintf("login: %s: %s", e.Code, e.Description)
+}
+
+// RedirectToLogin starts a new AuthRequest, saves it in the configured store
+// and redirects the user to Vipps to log in.
+func (p *Provider) RedirectToLogin(w http.ResponseWriter, r *http.Request) error {
+	if p.store == nil {
+		return ErrNoStore
+	}
+	req, err := p.NewAuthRequest()
+	if err != nil {
+		return err
+	}
+	if err := p.store.Save(w, r, req); err != nil {
+		return err
+	}
+	http.Redirect(w, r, req.URL, http.StatusFound)
+	return nil
+}
+
+// HandleRedirect completes the AuthRequest started by RedirectToLogin, when
+// the user is redirected back to the RedirectURL, and returns the claims of the
+// user. It returns an *AuthError if Vipps returned an error, and an error
+// wrapping ErrInvalidState if the state does not match the stored AuthRequest.
+func (p *Provider) HandleRedirect(w http.ResponseWriter, r *http.Request) (*Claims, error) {
+	q := r.URL.Query()
+	if code := q.Get("error"); code != "" {
+		return nil, &AuthError{Code: code, Description: q.Get("error_description")}
+	}
+	if p.store == nil {
+		return nil, ErrNoStore
+	}
+	state := q.Get("state")
+	if state == "" {
+		return nil, ErrInvalidState
+	}
+	req, err := p.store.Load(w, r, state)
+	if err != nil {
+		return nil, err
+	}
+	return p.ExchangeAuthRequest(r.Context(), q.Get("code"), req)
+}
+
 // ExchangeCodeForClaims takes an oauth2 authorization code, exchanges it for a
-// token, and returns the contained ID token's claims, if any
-func (p *Provider) ExchangeCodeForClaims(ctx context.Context, code string) (*Claims, error) {
-	token, err := p.oauthConfig.Exchange(ctx, code)
+// token, and returns the contained ID token's claims, if any. It checks
+// neither a nonce nor PKCE; prefer HandleRedirect or ExchangeAuthRequest.
+func (p *Provider) ExchangeCodeForClaims(ctx context.Context, code string) (_ *Claims, err error) {
+	ctx, span := vipps.StartSpan(ctx, p.tracer, vipps.SpanKindClient, "login.ExchangeCodeForClaims")
+	defer func() { vipps.EndSpan(span, err) }()
+
+	return p.exchange(ctx, code, nil)
+}
+
+// ExchangeAuthRequest is like ExchangeCodeForClaims for a code returned for
+// req, e.g. by a NewAuthRequest kept in an AuthRequestStore of your own. The
+// code verifier of req is sent, and the nonce claim of the ID token must match
+// its nonce.
+func (p *Provider) ExchangeAuthRequest(ctx context.Context, code string, req *AuthRequest) (_ *Claims, err error) {
+	ctx, span := vipps.StartSpan(ctx, p.tracer, vipps.SpanKindClient, "login.ExchangeAuthRequest")
+	defer func() { vipps.EndSpan(span, err) }()
+
+	return p.exchange(ctx, code, req)
+}
+
+// exchange exchanges code for claims, checking req if it is not nil.
+func (p *Provider) exchange(ctx context.Context, code string, req *AuthRequest) (*Claims, error) {
+	var opts []oauth2.AuthCodeOption
+	if req != nil {
+		opts = append(opts, oauth2.SetAuthURLParam("code_verifier", req.CodeVerifier))
+	}
+	token, err := p.oauthConfig.Exchange(ctx, code, opts...)
 	if err != nil {
 		return nil, err
 
@@ -164,6 +269,9 @@ func (p *Provider) ExchangeCodeForClaims(ctx context.Context, code string) (*Cla
 	if err != nil {
 		return nil, err
 	}
+	if req != nil && !equal(idToken.Nonce, req.Nonce) {
+		return nil, ErrInvalidNonce
+	}
 
 	claims := Claims{
 		UserID: idToken.Subject,
@@ -0,0 +1,80 @@
+package login
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"golang.org/x/oauth2"
+)
+
+// Errors returned when an authorization response cannot be trusted.
+var (
+	// ErrInvalidState is returned when the state of an authorization response
+	// does not match a stored AuthRequest, e.g. because it was forged, used
+	// before or has expired.
+	ErrInvalidState = errors.New("login: invalid state")
+	// ErrInvalidNonce is returned when the nonce claim of an ID token does not
+	// match the AuthRequest it was requested with.
+	ErrInvalidNonce = errors.New("login: invalid nonce")
+	// ErrNoStore is returned by RedirectToLogin and HandleRedirect for a
+	// Provider without an AuthRequestStore.
+	ErrNoStore = errors.New("login: no AuthRequestStore configured")
+)
+
+// AuthRequest represents an authorization request, and the secrets needed to
+// complete it. State, Nonce and CodeVerifier must be kept from the user agent
+// until the user is redirected back, see AuthRequestStore.
+type AuthRequest struct {
+	// URL is where the user is sent to log in.
+	URL string `json:"-"`
+	// State binds the authorization response to the user agent it was
+	// requested by.
+	State string `json:"state"`
+	// Nonce binds the ID token to the request.
+	Nonce string `json:"nonce"`
+	// CodeVerifier is the PKCE secret that the S256 code challenge in URL is
+	// derived from.
+	CodeVerifier string `json:"code_verifier"`
+}
+
+// NewAuthRequest returns an AuthRequest with a random state, nonce and PKCE
+// code verifier, for the configured scopes.
+func (p *Provider) NewAuthRequest() (*AuthRequest, error) {
+	var req AuthRequest
+	for _, s := range []*string{&req.State, &req.Nonce, &req.CodeVerifier} {
+		v, err := randomString()
+		if err != nil {
+			return nil, err
+		}
+		*s = v
+	}
+	req.URL = p.oauthConfig.AuthCodeURL(req.State,
+		oauth2.SetAuthURLParam("nonce", req.Nonce),
+		oauth2.SetAuthURLParam("code_challenge", codeChallenge(req.CodeVerifier)),
+		oauth2.SetAuthURLParam("code_challenge_method", "S256"),
+	)
+	return &req, nil
+}
+
+// codeChallenge returns the S256 PKCE code challenge of verifier.
+func codeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// equal reports whether a and b are equal, in constant time.
+func equal(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// randomString returns 32 random bytes, base64url encoded. The result is a
+// valid PKCE code verifier.
+func randomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
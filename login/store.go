@@ -0,0 +1,171 @@
+package login
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+)
+
+const (
+	// DefaultCookieName is the name of the cookie a CookieStore keeps
+	// AuthRequests in by default.
+	DefaultCookieName = "vipps_login"
+	// DefaultAuthRequestLifetime is how long an AuthRequest can be completed
+	// by default.
+	DefaultAuthRequestLifetime = 10 * time.Minute
+	// CookieKeySize is the size of the key of a CookieStore.
+	CookieKeySize = 32
+)
+
+// ErrInvalidCookieKey is returned for a CookieStore whose Key is not
+// CookieKeySize bytes.
+var ErrInvalidCookieKey = errors.New("login: cookie key must be 32 bytes")
+
+// AuthRequestStore keeps AuthRequests between the redirect to Vipps and the
+// redirect back. A server-side store, e.g. one keyed by a session, can be
+// plugged in by implementing it.
+type AuthRequestStore interface {
+	// Save stores req for the user agent of r.
+	Save(w http.ResponseWriter, r *http.Request, req *AuthRequest) error
+	// Load returns and removes the AuthRequest with the given state stored
+	// for the user agent of r, or an error wrapping ErrInvalidState if there
+	// is none.
+	Load(w http.ResponseWriter, r *http.Request, state string) (*AuthRequest, error)
+}
+
+// CookieStore is an AuthRequestStore that keeps an AuthRequest in a cookie in
+// the user agent, encrypted with AES-GCM so that the code verifier and nonce
+// can not be read or changed. Only the latest AuthRequest of a user agent can
+// be completed.
+type CookieStore struct {
+	// Key encrypts the cookies. It must be CookieKeySize random bytes, and
+	// the same for every instance of a service.
+	Key []byte
+	// Name is the name of the cookie, DefaultCookieName if empty.
+	Name string
+	// Path is the path of the cookie, "/" if empty.
+	Path string
+	// MaxAge is how long an AuthRequest can be completed,
+	// DefaultAuthRequestLifetime if zero.
+	MaxAge time.Duration
+	// Insecure allows the cookie to be sent over plain http, e.g. to
+	// localhost during development.
+	Insecure bool
+}
+
+// NewCookieStore returns a CookieStore encrypting cookies with key, or
+// ErrInvalidCookieKey if key is not CookieKeySize bytes.
+func NewCookieStore(key []byte) (*CookieStore, error) {
+	if len(key) != CookieKeySize {
+		return nil, ErrInvalidCookieKey
+	}
+	return &CookieStore{Key: key}, nil
+}
+
+// cookieValue is the encrypted content of a cookie.
+type cookieValue struct {
+	AuthRequest
+	Expires int64 `json:"exp"`
+}
+
+// Save satisfies AuthRequestStore.
+func (s *CookieStore) Save(w http.ResponseWriter, r *http.Request, req *AuthRequest) error {
+	aead, err := s.aead()
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(cookieValue{
+		AuthRequest: *req,
+		Expires:     time.Now().Add(s.maxAge()).Unix(),
+	})
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	sealed := aead.Seal(nonce, nonce, b, []byte(s.name()))
+	http.SetCookie(w, s.cookie(base64.RawURLEncoding.EncodeToString(sealed), int(s.maxAge().Seconds())))
+	return nil
+}
+
+// Load satisfies AuthRequestStore. The cookie is cleared, so that the
+// AuthRequest can be completed only once.
+func (s *CookieStore) Load(w http.ResponseWriter, r *http.Request, state string) (*AuthRequest, error) {
+	aead, err := s.aead()
+	if err != nil {
+		return nil, err
+	}
+	c, err := r.Cookie(s.name())
+	if err != nil {
+		return nil, ErrInvalidState
+	}
+	http.SetCookie(w, s.cookie("", -1))
+
+	sealed, err := base64.RawURLEncoding.DecodeString(c.Value)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return nil, ErrInvalidState
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	b, err := aead.Open(nil, nonce, ciphertext, []byte(s.name()))
+	if err != nil {
+		return nil, ErrInvalidState
+	}
+	var v cookieValue
+	if err := json.Unmarshal(b, &v); err != nil {
+		return nil, ErrInvalidState
+	}
+	if time.Now().Unix() > v.Expires || !equal(v.State, state) {
+		return nil, ErrInvalidState
+	}
+	return &v.AuthRequest, nil
+}
+
+func (s *CookieStore) aead() (cipher.AEAD, error) {
+	if len(s.Key) != CookieKeySize {
+		return nil, ErrInvalidCookieKey
+	}
+	block, err := aes.NewCipher(s.Key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (s *CookieStore) cookie(value string, maxAge int) *http.Cookie {
+	path := s.Path
+	if path == "" {
+		path = "/"
+	}
+	return &http.Cookie{
+		Name:     s.name(),
+		Value:    value,
+		Path:     path,
+		MaxAge:   maxAge,
+		Secure:   !s.Insecure,
+		HttpOnly: true,
+		// Lax, so that the cookie is sent with the top-level redirect back
+		// from Vipps.
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+func (s *CookieStore) name() string {
+	if s.Name == "" {
+		return DefaultCookieName
+	}
+	return s.Name
+}
+
+func (s *CookieStore) maxAge() time.Duration {
+	if s.MaxAge == 0 {
+		return DefaultAuthRequestLifetime
+	}
+	return s.MaxAge
+}
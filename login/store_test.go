@@ -0,0 +1,185 @@
+package login
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testKey() []byte {
+	return bytes.Repeat([]byte{1}, CookieKeySize)
+}
+
+// save saves req in s, and returns the cookies set.
+func save(t *testing.T, s *CookieStore, req *AuthRequest) []*http.Cookie {
+	t.Helper()
+	w := httptest.NewRecorder()
+	if err := s.Save(w, httptest.NewRequest(http.MethodGet, "/login", nil), req); err != nil {
+		t.Fatal(err)
+	}
+	return w.Result().Cookies()
+}
+
+// load loads the AuthRequest with state from s, sending cookies.
+func load(s *CookieStore, cookies []*http.Cookie, state string) (*AuthRequest, []*http.Cookie, error) {
+	r := httptest.NewRequest(http.MethodGet, "/redirect", nil)
+	for _, c := range cookies {
+		r.AddCookie(c)
+	}
+	w := httptest.NewRecorder()
+	req, err := s.Load(w, r, state)
+	return req, w.Result().Cookies(), err
+}
+
+func TestCookieStore(t *testing.T) {
+	req := &AuthRequest{URL: "https://example.com", State: "state", Nonce: "nonce", CodeVerifier: "verifier"}
+	tamper := func(cookies []*http.Cookie) []*http.Cookie {
+		c := *cookies[0]
+		b := []byte(c.Value)
+		if b[len(b)/2] == 'A' {
+			b[len(b)/2] = 'B'
+		} else {
+			b[len(b)/2] = 'A'
+		}
+		c.Value = string(b)
+		return []*http.Cookie{&c}
+	}
+	tests := []struct {
+		name    string
+		store   *CookieStore
+		loadBy  *CookieStore
+		state   string
+		cookies func([]*http.Cookie) []*http.Cookie
+		wantErr error
+	}{
+		{
+			name:  "round trip",
+			store: &CookieStore{Key: testKey()},
+			state: "state",
+		},
+		{
+			name:    "wrong state",
+			store:   &CookieStore{Key: testKey()},
+			state:   "other",
+			wantErr: ErrInvalidState,
+		},
+		{
+			name:    "no cookie",
+			store:   &CookieStore{Key: testKey()},
+			state:   "state",
+			cookies: func([]*http.Cookie) []*http.Cookie { return nil },
+			wantErr: ErrInvalidState,
+		},
+		{
+			name:    "tampered",
+			store:   &CookieStore{Key: testKey()},
+			state:   "state",
+			cookies: tamper,
+			wantErr: ErrInvalidState,
+		},
+		{
+			name:    "other key",
+			store:   &CookieStore{Key: testKey()},
+			loadBy:  &CookieStore{Key: bytes.Repeat([]byte{2}, CookieKeySize)},
+			state:   "state",
+			wantErr: ErrInvalidState,
+		},
+		{
+			name:    "other cookie name",
+			store:   &CookieStore{Key: testKey(), Name: "a"},
+			loadBy:  &CookieStore{Key: testKey(), Name: "b"},
+			state:   "state",
+			wantErr: ErrInvalidState,
+		},
+		{
+			name:    "expired",
+			store:   &CookieStore{Key: testKey(), MaxAge: -2 * time.Second},
+			state:   "state",
+			wantErr: ErrInvalidState,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cookies := save(t, tt.store, req)
+			if tt.cookies != nil {
+				cookies = tt.cookies(cookies)
+			}
+			loadBy := tt.loadBy
+			if loadBy == nil {
+				loadBy = tt.store
+			}
+			got, _, err := load(loadBy, cookies, tt.state)
+			if err != tt.wantErr {
+				t.Fatalf("Load = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got.State != req.State || got.Nonce != req.Nonce || got.CodeVerifier != req.CodeVerifier {
+				t.Errorf("Load = %+v, want %+v", got, req)
+			}
+		})
+	}
+}
+
+func TestCookieStoreCookie(t *testing.T) {
+	s := &CookieStore{Key: testKey()}
+	req := &AuthRequest{State: "state", Nonce: "nonce", CodeVerifier: "verifier"}
+	cookies := save(t, s, req)
+	if len(cookies) != 1 {
+		t.Fatalf("cookies = %v, want one", cookies)
+	}
+	c := cookies[0]
+	if c.Name != DefaultCookieName || c.Path != "/" || !c.Secure || !c.HttpOnly || c.SameSite != http.SameSiteLaxMode {
+		t.Errorf("cookie = %+v", c)
+	}
+	for _, secret := range []string{req.Nonce, req.CodeVerifier} {
+		if strings.Contains(c.Value, secret) {
+			t.Errorf("cookie value %q contains %q", c.Value, secret)
+		}
+	}
+
+	// The cookie is cleared, so that the request can not be replayed.
+	_, cleared, err := load(s, cookies, "state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cleared) != 1 || cleared[0].Value != "" || cleared[0].MaxAge >= 0 {
+		t.Errorf("cookies after Load = %v, want cleared", cleared)
+	}
+	if _, _, err := load(s, cleared, "state"); err != ErrInvalidState {
+		t.Errorf("Load after clearing = %v, want %v", err, ErrInvalidState)
+	}
+}
+
+func TestCookieStoreKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		key     []byte
+		wantErr error
+	}{
+		{"valid", testKey(), nil},
+		{"missing", nil, ErrInvalidCookieKey},
+		{"short", []byte("short"), ErrInvalidCookieKey},
+		{"long", bytes.Repeat([]byte{1}, 2*CookieKeySize), ErrInvalidCookieKey},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewCookieStore(tt.key); err != tt.wantErr {
+				t.Errorf("NewCookieStore = %v, want %v", err, tt.wantErr)
+			}
+			s := &CookieStore{Key: tt.key}
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/login", nil)
+			if err := s.Save(w, r, &AuthRequest{State: "state"}); err != tt.wantErr {
+				t.Errorf("Save = %v, want %v", err, tt.wantErr)
+			}
+			if _, err := s.Load(w, r, "state"); tt.wantErr != nil && err != tt.wantErr {
+				t.Errorf("Load = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
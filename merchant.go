@@ -0,0 +1,25 @@
+package vipps
+
+import (
+	"context"
+	"github.com/torfjor/go-vipps/internal"
+)
+
+// ContextWithMerchant returns a copy of ctx carrying msn, the serial number of
+// the merchant (sales unit) that calls with the context are made on behalf
+// of:
+//
+//	ctx = vipps.ContextWithMerchant(ctx, "123456")
+//	client.CapturePayment(ctx, cmd)
+//
+// A serial number given on a command takes precedence, and the
+// MerchantSerialNumber of the ClientConfig is used if there is none.
+func ContextWithMerchant(ctx context.Context, msn string) context.Context {
+	return internal.ContextWithMerchant(ctx, msn)
+}
+
+// MerchantFromContext returns the serial number carried by ctx, or "" if
+// none.
+func MerchantFromContext(ctx context.Context) string {
+	return internal.MerchantFromContext(ctx)
+}
@@ -0,0 +1,97 @@
+package vipps
+
+import (
+	"context"
+	"github.com/go-kit/kit/metrics"
+	"github.com/torfjor/go-vipps/internal"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Metrics are the instruments updated by Clients, the auth transport and the
+// callback handlers. They are go-kit metrics, so that any backend can be used;
+// package prometheus provides Metrics backed by Prometheus collectors. Nil
+// instruments are not updated.
+type Metrics struct {
+	// Requests counts requests, by "operation" and "status". Every attempt of
+	// a retried request is counted.
+	Requests metrics.Counter
+	// Latency observes the duration of requests in seconds, by "operation"
+	// and "status".
+	Latency metrics.Histogram
+	// Retries counts attempts after the first of retried requests, by
+	// "operation".
+	Retries metrics.Counter
+	// TokenFetches counts fetches of access tokens, by "result", which is
+	// either "success" or "failure".
+	TokenFetches metrics.Counter
+	// Callbacks counts transaction updates received from Vipps, by "status"
+	// of the transaction.
+	Callbacks metrics.Counter
+}
+
+// Label values of Metrics.
+const (
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+	// StatusError is the status of requests that failed without a response.
+	StatusError = "error"
+)
+
+type operationKey struct{}
+
+// Operation returns the operation that ctx was started for with StartSpan,
+// e.g. `ecom.CapturePayment`, or "" if none.
+func Operation(ctx context.Context) string {
+	op, _ := ctx.Value(operationKey{}).(string)
+	return op
+}
+
+// Instrument returns a Middleware that updates the request metrics of m for
+// every request.
+func Instrument(m *Metrics) Middleware {
+	return func(next Doer) Doer {
+		return DoerFunc(func(req *http.Request) (*http.Response, error) {
+			op := Operation(req.Context())
+			if m.Retries != nil && internal.Attempt(req.Context()) > 1 {
+				m.Retries.With("operation", op).Add(1)
+			}
+
+			start := time.Now()
+			resp, err := next.Do(req)
+			status := StatusError
+			if err == nil {
+				status = strconv.Itoa(resp.StatusCode)
+			}
+			if m.Requests != nil {
+				m.Requests.With("operation", op, "status", status).Add(1)
+			}
+			if m.Latency != nil {
+				m.Latency.With("operation", op, "status", status).Observe(time.Since(start).Seconds())
+			}
+			return resp, err
+		})
+	}
+}
+
+// CountTokenFetch counts a fetch of an access token that failed with err, if
+// any, or with the HTTP status of resp.
+func (m *Metrics) CountTokenFetch(resp *http.Response, err error) {
+	if m == nil || m.TokenFetches == nil {
+		return
+	}
+	result := ResultSuccess
+	if err != nil || resp.StatusCode < http.StatusOK || resp.StatusCode > 299 {
+		result = ResultFailure
+	}
+	m.TokenFetches.With("result", result).Add(1)
+}
+
+// CountCallback counts a transaction update with the given status.
+func (m *Metrics) CountCallback(status string) {
+	if m == nil || m.Callbacks == nil {
+		return
+	}
+	m.Callbacks.With("status", status).Add(1)
+}
@@ -0,0 +1,78 @@
+package vipps
+
+import (
+	"github.com/go-kit/kit/log"
+	"net/http"
+	"time"
+)
+
+// Doer sends HTTP requests to the Vipps APIs. It is satisfied by
+// *http.Client.
+type Doer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// DoerFunc is an adapter to allow the use of ordinary functions as Doers.
+type DoerFunc func(req *http.Request) (*http.Response, error)
+
+// Do calls f(req).
+func (f DoerFunc) Do(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// Middleware wraps a Doer to add behaviour to every request sent by a Client,
+// e.g. tracing, metrics, auditing or header injection:
+//
+//	func WithHeader(key, value string) vipps.Middleware {
+//		return func(next vipps.Doer) vipps.Doer {
+//			return vipps.DoerFunc(func(req *http.Request) (*http.Response, error) {
+//				req.Header.Set(key, value)
+//				return next.Do(req)
+//			})
+//		}
+//	}
+//
+// Middleware sees every attempt of a request that is retried.
+type Middleware func(next Doer) Doer
+
+// Chain returns d wrapped in middleware, with the first middleware outermost.
+func Chain(d Doer, middleware ...Middleware) Doer {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		d = middleware[i](d)
+	}
+	return d
+}
+
+// LogRequests returns a Middleware that logs the method, URL, status and
+// duration of every request with logger.
+func LogRequests(logger log.Logger) Middleware {
+	return func(next Doer) Doer {
+		return DoerFunc(func(req *http.Request) (*http.Response, error) {
+			start := time.Now()
+			resp, err := next.Do(req)
+			if err != nil {
+				logger.Log("method", req.Method, "url", req.URL, "duration", time.Since(start), "err", err)
+				return nil, err
+			}
+			logger.Log("method", req.Method, "url", req.URL, "status", resp.StatusCode, "duration", time.Since(start))
+			return resp, nil
+		})
+	}
+}
+
+// Doer returns the HTTPClient wrapped in the Middleware. LogRequests with the
+// Logger, Instrument with the Metrics and Trace with the Tracer, if set, come
+// first.
+func (c ClientConfig) Doer() Doer {
+	var middleware []Middleware
+	if c.Logger != nil {
+		middleware = append(middleware, LogRequests(c.Logger))
+	}
+	if c.Metrics != nil {
+		middleware = append(middleware, Instrument(c.Metrics))
+	}
+	if c.Tracer != nil {
+		middleware = append(middleware, Trace(c.Tracer))
+	}
+	return Chain(c.HTTPClient, append(middleware, c.Middleware...)...)
+}
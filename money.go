@@ -0,0 +1,153 @@
+package vipps
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Currency is an ISO 4217 currency code.
+type Currency string
+
+// List of values that Currency can take.
+const (
+	CurrencyNOK Currency = "NOK"
+)
+
+// Errors returned by Money arithmetic and encoding.
+var (
+	ErrNegativeAmount   = errors.New("vipps: negative amount")
+	ErrAmountOverflow   = errors.New("vipps: amount overflow")
+	ErrCurrencyMismatch = errors.New("vipps: currency mismatch")
+)
+
+// Money represents an amount of money in the minor unit of its currency, e.g.
+// øre for NOK. An empty Currency means NOK.
+//
+// Money is encoded in JSON as an integer number of minor units, which is how
+// the Ecom and Recurring APIs represent amounts. Package epayment encodes it as
+// the object with a currency and a value that the ePayment API uses. Negative
+// amounts can not be encoded.
+type Money struct {
+	Minor    int64
+	Currency Currency
+}
+
+// Ore returns an amount of NOK given in øre.
+func Ore(ore int64) Money {
+	return Money{Minor: ore, Currency: CurrencyNOK}
+}
+
+// Kroner returns an amount of NOK given in kroner, rounded to the nearest øre.
+func Kroner(kroner float64) (Money, error) {
+	ore := math.Round(kroner * 100)
+	switch {
+	case math.IsNaN(ore):
+		return Money{}, fmt.Errorf("vipps: invalid amount %v", kroner)
+	case ore < 0:
+		return Money{}, ErrNegativeAmount
+	case ore >= math.MaxInt64:
+		return Money{}, ErrAmountOverflow
+	}
+	return Ore(int64(ore)), nil
+}
+
+func (m Money) currency() Currency {
+	if m.Currency == "" {
+		return CurrencyNOK
+	}
+	return m.Currency
+}
+
+// IsZero reports whether m is zero.
+func (m Money) IsZero() bool {
+	return m.Minor == 0
+}
+
+// Add returns m + o. It fails if the currencies differ, either amount is
+// negative or the sum overflows.
+func (m Money) Add(o Money) (Money, error) {
+	if err := m.compatible(o); err != nil {
+		return Money{}, err
+	}
+	if m.Minor > math.MaxInt64-o.Minor {
+		return Money{}, ErrAmountOverflow
+	}
+	return Money{Minor: m.Minor + o.Minor, Currency: m.currency()}, nil
+}
+
+// Sub returns m - o. It fails if the currencies differ, either amount is
+// negative or o is larger than m.
+func (m Money) Sub(o Money) (Money, error) {
+	if err := m.compatible(o); err != nil {
+		return Money{}, err
+	}
+	if o.Minor > m.Minor {
+		return Money{}, ErrNegativeAmount
+	}
+	return Money{Minor: m.Minor - o.Minor, Currency: m.currency()}, nil
+}
+
+func (m Money) compatible(o Money) error {
+	if m.currency() != o.currency() {
+		return ErrCurrencyMismatch
+	}
+	if m.Minor < 0 || o.Minor < 0 {
+		return ErrNegativeAmount
+	}
+	return nil
+}
+
+// Kroner returns m in major units, e.g. kroner for NOK.
+func (m Money) Kroner() float64 {
+	return float64(m.Minor) / 100
+}
+
+// String formats m the Norwegian way, e.g. `kr 1 234,50` for NOK and
+// `1 234,50 SEK` for other currencies.
+func (m Money) String() string {
+	minor := m.Minor
+	sign := ""
+	if minor < 0 {
+		sign = "-"
+		minor = -minor
+	}
+	major := strconv.FormatUint(uint64(minor)/100, 10)
+
+	var b strings.Builder
+	for i, d := range major {
+		if i > 0 && (len(major)-i)%3 == 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteRune(d)
+	}
+	amount := fmt.Sprintf("%s%s,%02d", sign, b.String(), uint64(minor)%100)
+
+	if c := m.currency(); c != CurrencyNOK {
+		return amount + " " + string(c)
+	}
+	return "kr " + amount
+}
+
+// MarshalJSON satisfies json.Marshaler.
+func (m Money) MarshalJSON() ([]byte, error) {
+	if m.Minor < 0 {
+		return nil, ErrNegativeAmount
+	}
+	return []byte(strconv.FormatInt(m.Minor, 10)), nil
+}
+
+// UnmarshalJSON satisfies json.Unmarshaler. The decoded amount is in NOK.
+func (m *Money) UnmarshalJSON(b []byte) error {
+	var minor *int64
+	if err := json.Unmarshal(b, &minor); err != nil {
+		return err
+	}
+	if minor != nil {
+		*m = Ore(*minor)
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package vipps
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestMoneyAdd(t *testing.T) {
+	tests := []struct {
+		name    string
+		m, o    Money
+		want    Money
+		wantErr error
+	}{
+		{"sum", Ore(150), Ore(250), Ore(400), nil},
+		{"empty currency is NOK", Money{Minor: 1}, Ore(2), Ore(3), nil},
+		{"other currency", Money{Minor: 1, Currency: "SEK"}, Money{Minor: 2, Currency: "SEK"}, Money{Minor: 3, Currency: "SEK"}, nil},
+		{"currency mismatch", Ore(1), Money{Minor: 1, Currency: "SEK"}, Money{}, ErrCurrencyMismatch},
+		{"negative", Ore(-1), Ore(1), Money{}, ErrNegativeAmount},
+		{"overflow", Ore(math.MaxInt64), Ore(1), Money{}, ErrAmountOverflow},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.m.Add(tt.o)
+			if !errors.Is(err, tt.wantErr) || got != tt.want {
+				t.Errorf("Add = %v, %v, want %v, %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMoneySub(t *testing.T) {
+	tests := []struct {
+		name    string
+		m, o    Money
+		want    Money
+		wantErr error
+	}{
+		{"difference", Ore(400), Ore(150), Ore(250), nil},
+		{"zero", Ore(400), Ore(400), Ore(0), nil},
+		{"below zero", Ore(150), Ore(400), Money{}, ErrNegativeAmount},
+		{"negative", Ore(150), Ore(-1), Money{}, ErrNegativeAmount},
+		{"currency mismatch", Ore(1), Money{Minor: 1, Currency: "SEK"}, Money{}, ErrCurrencyMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.m.Sub(tt.o)
+			if !errors.Is(err, tt.wantErr) || got != tt.want {
+				t.Errorf("Sub = %v, %v, want %v, %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestKroner(t *testing.T) {
+	tests := []struct {
+		name    string
+		kroner  float64
+		want    Money
+		wantErr bool
+	}{
+		{"whole", 12, Ore(1200), false},
+		{"fraction", 12.34, Ore(1234), false},
+		{"rounded", 0.125, Ore(13), false},
+		{"zero", 0, Ore(0), false},
+		{"negative", -1, Money{}, true},
+		{"NaN", math.NaN(), Money{}, true},
+		{"overflow", math.MaxFloat64, Money{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Kroner(tt.kroner)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("Kroner(%v) = %v, %v, want %v, error %v", tt.kroner, got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+
+	if got := Ore(1234).Kroner(); got != 12.34 {
+		t.Errorf("Ore(1234).Kroner() = %v, want 12.34", got)
+	}
+}
+
+func TestMoneyString(t *testing.T) {
+	tests := []struct {
+		m    Money
+		want string
+	}{
+		{Ore(0), "kr 0,00"},
+		{Ore(5), "kr 0,05"},
+		{Ore(123450), "kr 1 234,50"},
+		{Ore(123456789), "kr 1 234 567,89"},
+		{Ore(-123450), "kr -1 234,50"},
+		{Money{Minor: 100}, "kr 1,00"},
+		{Money{Minor: 123450, Currency: "SEK"}, "1 234,50 SEK"},
+		{Ore(math.MinInt64), "kr -92 233 720 368 547 758,08"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := tt.m.String(); got != tt.want {
+				t.Errorf("String = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMoneyJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		m       Money
+		want    string
+		wantErr bool
+	}{
+		{"amount", Ore(1234), "1234", false},
+		{"zero", Ore(0), "0", false},
+		{"negative", Ore(-1), "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := json.Marshal(tt.m)
+			if (err != nil) != tt.wantErr || string(b) != tt.want {
+				t.Fatalf("Marshal = %s, %v, want %s, error %v", b, err, tt.want, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			var m Money
+			if err := json.Unmarshal(b, &m); err != nil || m != tt.m {
+				t.Errorf("Unmarshal = %v, %v, want %v", m, err, tt.m)
+			}
+		})
+	}
+
+	t.Run("null", func(t *testing.T) {
+		m := Ore(1)
+		if err := json.Unmarshal([]byte("null"), &m); err != nil || m != Ore(1) {
+			t.Errorf("Unmarshal = %v, %v, want %v", m, err, Ore(1))
+		}
+	})
+	t.Run("not a number", func(t *testing.T) {
+		var m Money
+		if err := json.Unmarshal([]byte(`"12"`), &m); err == nil {
+			t.Error("Unmarshal succeeded, want error")
+		}
+	})
+}
@@ -0,0 +1,184 @@
+package vipps
+
+import (
+	"errors"
+	"fmt"
+	"github.com/go-kit/kit/log"
+	"net/http"
+	"strings"
+)
+
+// ErrInvalidConfig is returned for a ClientConfig or Credentials that a Client
+// cannot be built from.
+var ErrInvalidConfig = errors.New("vipps: invalid config")
+
+// Option configures a Client, see the New functions of the API packages:
+//
+//	client, err := ecom.New(
+//		vipps.WithEnvironment(vipps.EnvironmentTesting),
+//		vipps.WithCredentials(credentials),
+//		vipps.WithMerchantSerialNumber("123456"),
+//	)
+type Option func(*ClientConfig)
+
+// NewConfig returns a ClientConfig with opts applied, or an error if it is
+// invalid.
+func NewConfig(opts ...Option) (ClientConfig, error) {
+	var c ClientConfig
+	for _, opt := range opts {
+		opt(&c)
+	}
+	return c, c.Validate()
+}
+
+// Validate returns an error wrapping ErrInvalidConfig if c has neither a
+// HTTPClient nor valid Credentials, or neither a BaseURL nor a known
+// Environment. Unlike the NewClient functions, it does not take an empty
+// Environment to mean production.
+func (c ClientConfig) Validate() error {
+	var problems []string
+	if c.HTTPClient == nil {
+		if c.Credentials == (Credentials{}) {
+			problems = append(problems, "HTTPClient or Credentials is required")
+		} else if err := c.Credentials.Validate(); err != nil {
+			return err
+		}
+	}
+	if c.BaseURL == "" && c.Environment == "" {
+		problems = append(problems, "Environment or BaseURL is required")
+	} else if _, err := c.APIBaseURL(); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s", ErrInvalidConfig, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// Validate returns an error wrapping ErrInvalidConfig if any of the
+// credentials are missing.
+func (c Credentials) Validate() error {
+	var missing []string
+	if c.ClientID == "" {
+		missing = append(missing, "ClientID")
+	}
+	if c.ClientSecret == "" {
+		missing = append(missing, "ClientSecret")
+	}
+	if c.APISubscriptionKey == "" {
+		missing = append(missing, "APISubscriptionKey")
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%w: missing credentials: %s", ErrInvalidConfig, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// WithEnvironment sets the Environment.
+func WithEnvironment(env Environment) Option {
+	return func(c *ClientConfig) {
+		c.Environment = env
+	}
+}
+
+// WithBaseURL sets the BaseURL.
+func WithBaseURL(baseURL string) Option {
+	return func(c *ClientConfig) {
+		c.BaseURL = baseURL
+	}
+}
+
+// WithCredentials sets the Credentials, that the Client authenticates with
+// unless it is given a HTTPClient.
+func WithCredentials(credentials Credentials) Option {
+	return func(c *ClientConfig) {
+		c.Credentials = credentials
+	}
+}
+
+// WithHTTPClient sets the HTTPClient. It must add the headers required by the
+// Vipps APIs, like the client returned by auth.NewClient.
+func WithHTTPClient(client *http.Client) Option {
+	return func(c *ClientConfig) {
+		c.HTTPClient = client
+	}
+}
+
+// WithTransport sets the Transport that the Client authenticates on top of.
+func WithTransport(rt http.RoundTripper) Option {
+	return func(c *ClientConfig) {
+		c.Transport = rt
+	}
+}
+
+// WithLogger sets the Logger.
+func WithLogger(logger log.Logger) Option {
+	return func(c *ClientConfig) {
+		c.Logger = logger
+	}
+}
+
+// WithRetryPolicy sets the RetryPolicy.
+func WithRetryPolicy(p RetryPolicy) Option {
+	return func(c *ClientConfig) {
+		c.RetryPolicy = &p
+	}
+}
+
+// WithTracer sets the Tracer.
+func WithTracer(tracer Tracer) Option {
+	return func(c *ClientConfig) {
+		c.Tracer = tracer
+	}
+}
+
+// WithMetrics sets the Metrics.
+func WithMetrics(m *Metrics) Option {
+	return func(c *ClientConfig) {
+		c.Metrics = m
+	}
+}
+
+// WithMiddleware appends middleware to the Middleware.
+func WithMiddleware(middleware ...Middleware) Option {
+	return func(c *ClientConfig) {
+		c.Middleware = append(c.Middleware, middleware...)
+	}
+}
+
+// WithoutValidation sets SkipValidation.
+func WithoutValidation() Option {
+	return func(c *ClientConfig) {
+		c.SkipValidation = true
+	}
+}
+
+// WithIdempotencyStore sets the IdempotencyStore.
+func WithIdempotencyStore(store IdempotencyStore) Option {
+	return func(c *ClientConfig) {
+		c.IdempotencyStore = store
+	}
+}
+
+// WithMerchantSerialNumber sets the MerchantSerialNumber.
+func WithMerchantSerialNumber(msn string) Option {
+	return func(c *ClientConfig) {
+		c.MerchantSerialNumber = msn
+	}
+}
+
+// WithSystem sets the SystemName and SystemVersion.
+func WithSystem(name, version string) Option {
+	return func(c *ClientConfig) {
+		c.SystemName = name
+		c.SystemVersion = version
+	}
+}
+
+// WithPlugin sets the PluginName and PluginVersion.
+func WithPlugin(name, version string) Option {
+	return func(c *ClientConfig) {
+		c.PluginName = name
+		c.PluginVersion = version
+	}
+}
@@ -0,0 +1,85 @@
+// Package otel provides a vipps.Tracer backed by an OpenTelemetry
+// trace.Tracer:
+//
+//	tracer := otel.NewTracer(otelglobal.Tracer("github.com/torfjor/go-vipps"))
+//	httpClient := auth.NewClient(vipps.EnvironmentTesting, credentials, auth.WithTracer(tracer))
+//	client := ecom.NewClient(vipps.ClientConfig{HTTPClient: httpClient, Tracer: tracer})
+package otel
+
+import (
+	"context"
+	"fmt"
+	"github.com/torfjor/go-vipps"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tracer is a vipps.Tracer that starts OpenTelemetry spans.
+type Tracer struct {
+	tracer trace.Tracer
+}
+
+// NewTracer returns a Tracer starting spans with tracer.
+func NewTracer(tracer trace.Tracer) *Tracer {
+	return &Tracer{tracer: tracer}
+}
+
+// Start satisfies vipps.Tracer.
+func (t *Tracer) Start(ctx context.Context, name string, kind vipps.SpanKind, attrs ...vipps.Attribute) (context.Context, vipps.Span) {
+	ctx, s := t.tracer.Start(ctx, name,
+		trace.WithSpanKind(spanKind(kind)),
+		trace.WithAttributes(attributes(attrs)...),
+	)
+	return ctx, span{s}
+}
+
+// span is a vipps.Span backed by an OpenTelemetry span.
+type span struct {
+	span trace.Span
+}
+
+// SetAttributes satisfies vipps.Span.
+func (s span) SetAttributes(attrs ...vipps.Attribute) {
+	s.span.SetAttributes(attributes(attrs)...)
+}
+
+// RecordError satisfies vipps.Span.
+func (s span) RecordError(err error) {
+	s.span.RecordError(err)
+	s.span.SetStatus(codes.Error, err.Error())
+}
+
+// End satisfies vipps.Span.
+func (s span) End() {
+	s.span.End()
+}
+
+func spanKind(kind vipps.SpanKind) trace.SpanKind {
+	switch kind {
+	case vipps.SpanKindClient:
+		return trace.SpanKindClient
+	case vipps.SpanKindServer:
+		return trace.SpanKindServer
+	}
+	return trace.SpanKindInternal
+}
+
+func attributes(attrs []vipps.Attribute) []attribute.KeyValue {
+	kvs := make([]attribute.KeyValue, len(attrs))
+	for i, a := range attrs {
+		switch v := a.Value.(type) {
+		case string:
+			kvs[i] = attribute.String(a.Key, v)
+		case int:
+			kvs[i] = attribute.Int(a.Key, v)
+		case int64:
+			kvs[i] = attribute.Int64(a.Key, v)
+		case bool:
+			kvs[i] = attribute.Bool(a.Key, v)
+		default:
+			kvs[i] = attribute.String(a.Key, fmt.Sprint(v))
+		}
+	}
+	return kvs
+}
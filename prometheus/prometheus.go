@@ -0,0 +1,92 @@
+// Package prometheus provides vipps.Metrics backed by Prometheus collectors:
+//
+//	m, err := prometheus.NewMetrics(stdprometheus.DefaultRegisterer, "myapp")
+//	client := ecom.NewClient(vipps.ClientConfig{HTTPClient: httpClient, Metrics: m})
+//	handler := ecom.HandleTransactionUpdate(authToken, cb, ecom.WithMetrics(m))
+//	httpClient := auth.NewClient(vipps.EnvironmentTesting, credentials, auth.WithMetrics(m))
+package prometheus
+
+import (
+	kitprometheus "github.com/go-kit/kit/metrics/prometheus"
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
+	"github.com/torfjor/go-vipps"
+)
+
+// Collectors are the Prometheus collectors behind vipps.Metrics.
+type Collectors struct {
+	// Requests is `<namespace>_vipps_requests_total`.
+	Requests *stdprometheus.CounterVec
+	// Latency is `<namespace>_vipps_request_duration_seconds`.
+	Latency *stdprometheus.HistogramVec
+	// Retries is `<namespace>_vipps_retries_total`.
+	Retries *stdprometheus.CounterVec
+	// TokenFetches is `<namespace>_vipps_token_fetches_total`.
+	TokenFetches *stdprometheus.CounterVec
+	// Callbacks is `<namespace>_vipps_callbacks_total`.
+	Callbacks *stdprometheus.CounterVec
+}
+
+// NewCollectors returns unregistered Collectors with names in namespace.
+func NewCollectors(namespace string) *Collectors {
+	return &Collectors{
+		Requests: stdprometheus.NewCounterVec(stdprometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "vipps",
+			Name:      "requests_total",
+			Help:      "Requests sent to the Vipps APIs, by operation and status.",
+		}, []string{"operation", "status"}),
+		Latency: stdprometheus.NewHistogramVec(stdprometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "vipps",
+			Name:      "request_duration_seconds",
+			Help:      "Duration of requests sent to the Vipps APIs, by operation and status.",
+			Buckets:   stdprometheus.DefBuckets,
+		}, []string{"operation", "status"}),
+		Retries: stdprometheus.NewCounterVec(stdprometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "vipps",
+			Name:      "retries_total",
+			Help:      "Retried requests sent to the Vipps APIs, by operation.",
+		}, []string{"operation"}),
+		TokenFetches: stdprometheus.NewCounterVec(stdprometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "vipps",
+			Name:      "token_fetches_total",
+			Help:      "Fetches of access tokens, by result.",
+		}, []string{"result"}),
+		Callbacks: stdprometheus.NewCounterVec(stdprometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "vipps",
+			Name:      "callbacks_total",
+			Help:      "Transaction updates received from Vipps, by status.",
+		}, []string{"status"}),
+	}
+}
+
+// Collectors returns all collectors of c, e.g. to register them.
+func (c *Collectors) Collectors() []stdprometheus.Collector {
+	return []stdprometheus.Collector{c.Requests, c.Latency, c.Retries, c.TokenFetches, c.Callbacks}
+}
+
+// Metrics returns vipps.Metrics that update c.
+func (c *Collectors) Metrics() *vipps.Metrics {
+	return &vipps.Metrics{
+		Requests:     kitprometheus.NewCounter(c.Requests),
+		Latency:      kitprometheus.NewHistogram(c.Latency),
+		Retries:      kitprometheus.NewCounter(c.Retries),
+		TokenFetches: kitprometheus.NewCounter(c.TokenFetches),
+		Callbacks:    kitprometheus.NewCounter(c.Callbacks),
+	}
+}
+
+// NewMetrics registers new Collectors with names in namespace with reg, and
+// returns vipps.Metrics that update them.
+func NewMetrics(reg stdprometheus.Registerer, namespace string) (*vipps.Metrics, error) {
+	c := NewCollectors(namespace)
+	for _, collector := range c.Collectors() {
+		if err := reg.Register(collector); err != nil {
+			return nil, err
+		}
+	}
+	return c.Metrics(), nil
+}
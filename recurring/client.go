@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"github.com/go-kit/kit/log"
 	"github.com/torfjor/go-vipps"
+	"github.com/torfjor/go-vipps/auth"
 	"github.com/torfjor/go-vipps/internal"
 	"net/http"
 )
@@ -22,21 +23,52 @@ type Doer interface {
 type Client struct {
 	BaseURL   string
 	APIClient Doer
+	// SkipValidation disables the validation of commands before they are
+	// sent.
+	SkipValidation bool
+	// Tracer, if set, traces every call on the Client.
+	Tracer vipps.Tracer
+	// IdempotencyStore, if set, remembers the idempotency keys generated for
+	// commands that have none.
+	IdempotencyStore vipps.IdempotencyStore
 }
 
-// NewClient returns a configured Client.
+// NewClient returns a configured Client. It panics if config has no
+// HTTPClient, or an unknown Environment and no BaseURL. An empty Environment
+// means production. Use New to get an error instead.
 func NewClient(config vipps.ClientConfig) *Client {
-	var baseUrl string
-	var logger log.Logger
-
 	if config.HTTPClient == nil {
 		panic("config.HTTPClient cannot be nil")
 	}
+	c, err := newClient(config)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
 
-	if config.Environment == vipps.EnvironmentTesting {
-		baseUrl = vipps.BaseURLTesting
-	} else {
-		baseUrl = vipps.BaseURL
+// New returns a Client configured with opts, or an error if the configuration
+// is invalid. Unless it is given a HTTPClient, the Client authenticates with
+// the Credentials, see auth.NewFromConfig.
+func New(opts ...vipps.Option) (*Client, error) {
+	config, err := vipps.NewConfig(opts...)
+	if err != nil {
+		return nil, err
+	}
+	if config.HTTPClient == nil {
+		if config.HTTPClient, err = auth.NewFromConfig(config); err != nil {
+			return nil, err
+		}
+	}
+	return newClient(config)
+}
+
+func newClient(config vipps.ClientConfig) (*Client, error) {
+	var logger log.Logger
+
+	baseUrl, err := config.APIBaseURL()
+	if err != nil {
+		return nil, err
 	}
 
 	if config.Logger == nil {
@@ -49,13 +81,29 @@ func NewClient(config vipps.ClientConfig) *Client {
 		BaseURL: baseUrl,
 		APIClient: &internal.APIClient{
 			L: logger,
-			C: config.HTTPClient,
+			C: config.Doer(),
+			R: (*internal.RetryPolicy)(config.RetryPolicy),
+			H: config.Headers(),
 		},
-	}
+		SkipValidation:   config.SkipValidation,
+		Tracer:           config.Tracer,
+		IdempotencyStore: config.IdempotencyStore,
+	}, nil
 }
 
 // CreateCharge creates a Charge for an Agreement.
-func (c *Client) CreateCharge(ctx context.Context, cmd CreateChargeCommand) (*ChargeReference, error) {
+func (c *Client) CreateCharge(ctx context.Context, cmd CreateChargeCommand) (_ *ChargeReference, err error) {
+	ctx, span := vipps.StartSpan(ctx, c.Tracer, vipps.SpanKindClient, "recurring.CreateCharge", vipps.AgreementIDAttr(cmd.AgreementID))
+	defer func() { vipps.EndSpan(span, err) }()
+
+	if err := c.validate(cmd); err != nil {
+		return nil, err
+	}
+	key, done, err := internal.IdempotencyKey(ctx, internal.Logger(c.APIClient), c.IdempotencyStore,
+		fmt.Sprintf("recurring.CreateCharge/%s/%s/%d/%s", cmd.AgreementID, cmd.Due.Format("2006-01-02"), cmd.Amount.Minor, cmd.OrderID), cmd.IdempotencyKey)
+	if err != nil {
+		return nil, err
+	}
 	endpoint := fmt.Sprintf("%s/%s/%s/charges", c.BaseURL, recurringEndpoint, cmd.AgreementID)
 	method := http.MethodPost
 	res := ChargeReference{}
@@ -64,18 +112,28 @@ func (c *Client) CreateCharge(ctx context.Context, cmd CreateChargeCommand) (*Ch
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Add("Idempotency-Key", cmd.IdempotencyKey)
+	req.Header.Add("Idempotency-Key", key)
 
 	err = c.APIClient.Do(req, &res)
+	done(err)
 	if err != nil {
 		return nil, wrapErr(err)
 	}
+	res.IdempotencyKey = key
 
 	return &res, nil
 }
 
 // CaptureCharge captures reserved amounts on a Charge.
-func (c *Client) CaptureCharge(ctx context.Context, cmd CaptureChargeCommand) error {
+func (c *Client) CaptureCharge(ctx context.Context, cmd CaptureChargeCommand) (err error) {
+	ctx, span := vipps.StartSpan(ctx, c.Tracer, vipps.SpanKindClient, "recurring.CaptureCharge", vipps.AgreementIDAttr(cmd.AgreementID), vipps.ChargeIDAttr(cmd.ChargeID))
+	defer func() { vipps.EndSpan(span, err) }()
+
+	key, done, err := internal.IdempotencyKey(ctx, internal.Logger(c.APIClient), c.IdempotencyStore,
+		fmt.Sprintf("recurring.CaptureCharge/%s/%s", cmd.AgreementID, cmd.ChargeID), cmd.IdempotencyKey)
+	if err != nil {
+		return err
+	}
 	endpoint := fmt.Sprintf("%s/%s/%s/charges/%s/capture", c.BaseURL, recurringEndpoint, cmd.AgreementID, cmd.ChargeID)
 	method := http.MethodPost
 
@@ -83,9 +141,10 @@ func (c *Client) CaptureCharge(ctx context.Context, cmd CaptureChargeCommand) er
 	if err != nil {
 		return err
 	}
-	req.Header.Add("Idempotency-Key", cmd.IdempotencyKey)
+	req.Header.Add("Idempotency-Key", key)
 
 	err = c.APIClient.Do(req, nil)
+	done(err)
 	if err != nil {
 		return wrapErr(err)
 	}
@@ -94,7 +153,18 @@ func (c *Client) CaptureCharge(ctx context.Context, cmd CaptureChargeCommand) er
 }
 
 // RefundCharge refunds already captured amounts on a Charge.
-func (c *Client) RefundCharge(ctx context.Context, cmd RefundChargeCommand) error {
+func (c *Client) RefundCharge(ctx context.Context, cmd RefundChargeCommand) (err error) {
+	ctx, span := vipps.StartSpan(ctx, c.Tracer, vipps.SpanKindClient, "recurring.RefundCharge", vipps.AgreementIDAttr(cmd.AgreementID), vipps.ChargeIDAttr(cmd.ChargeID))
+	defer func() { vipps.EndSpan(span, err) }()
+
+	if err := c.validate(cmd); err != nil {
+		return err
+	}
+	key, done, err := internal.IdempotencyKey(ctx, internal.Logger(c.APIClient), c.IdempotencyStore,
+		fmt.Sprintf("recurring.RefundCharge/%s/%s/%d", cmd.AgreementID, cmd.ChargeID, cmd.Amount.Minor), cmd.IdempotencyKey)
+	if err != nil {
+		return err
+	}
 	endpoint := fmt.Sprintf("%s/%s/%s/charges/%s/refund", c.BaseURL, recurringEndpoint, cmd.AgreementID, cmd.ChargeID)
 	method := http.MethodPost
 
@@ -102,9 +172,10 @@ func (c *Client) RefundCharge(ctx context.Context, cmd RefundChargeCommand) erro
 	if err != nil {
 		return err
 	}
-	req.Header.Add("Idempotency-Key", cmd.IdempotencyKey)
+	req.Header.Add("Idempotency-Key", key)
 
 	err = c.APIClient.Do(req, nil)
+	done(err)
 	if err != nil {
 		return wrapErr(err)
 	}
@@ -114,7 +185,15 @@ func (c *Client) RefundCharge(ctx context.Context, cmd RefundChargeCommand) erro
 
 // CancelCharge deletes a Charge. Will error for Charges that are not in a
 // cancellable state.
-func (c *Client) CancelCharge(ctx context.Context, cmd DeleteChargeCommand) (*Charge, error) {
+func (c *Client) CancelCharge(ctx context.Context, cmd DeleteChargeCommand) (_ *Charge, err error) {
+	ctx, span := vipps.StartSpan(ctx, c.Tracer, vipps.SpanKindClient, "recurring.CancelCharge", vipps.AgreementIDAttr(cmd.AgreementID), vipps.ChargeIDAttr(cmd.ChargeID))
+	defer func() { vipps.EndSpan(span, err) }()
+
+	key, done, err := internal.IdempotencyKey(ctx, internal.Logger(c.APIClient), c.IdempotencyStore,
+		fmt.Sprintf("recurring.CancelCharge/%s/%s", cmd.AgreementID, cmd.ChargeID), cmd.IdempotencyKey)
+	if err != nil {
+		return nil, err
+	}
 	endpoint := fmt.Sprintf("%s/%s/%s/charges/%s", c.BaseURL, recurringEndpoint, cmd.AgreementID, cmd.ChargeID)
 	method := http.MethodDelete
 	res := Charge{}
@@ -123,9 +202,10 @@ func (c *Client) CancelCharge(ctx context.Context, cmd DeleteChargeCommand) (*Ch
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Add("Idempotency-Key", cmd.IdempotencyKey)
+	req.Header.Add("Idempotency-Key", key)
 
 	err = c.APIClient.Do(req, &res)
+	done(err)
 	if err != nil {
 		return nil, wrapErr(err)
 	}
@@ -134,7 +214,10 @@ func (c *Client) CancelCharge(ctx context.Context, cmd DeleteChargeCommand) (*Ch
 }
 
 // GetCharge gets a Charge associated with an Agreement.
-func (c *Client) GetCharge(ctx context.Context, cmd GetChargeCommand) (*Charge, error) {
+func (c *Client) GetCharge(ctx context.Context, cmd GetChargeCommand) (_ *Charge, err error) {
+	ctx, span := vipps.StartSpan(ctx, c.Tracer, vipps.SpanKindClient, "recurring.GetCharge", vipps.AgreementIDAttr(cmd.AgreementID), vipps.ChargeIDAttr(cmd.ChargeID))
+	defer func() { vipps.EndSpan(span, err) }()
+
 	endpoint := fmt.Sprintf("%s/%s/%s/charges/%s", c.BaseURL, recurringEndpoint, cmd.AgreementID, cmd.ChargeID)
 	method := http.MethodGet
 	res := Charge{}
@@ -153,7 +236,10 @@ func (c *Client) GetCharge(ctx context.Context, cmd GetChargeCommand) (*Charge,
 }
 
 // ListCharges lists Charges associated with an Agreement.
-func (c *Client) ListCharges(ctx context.Context, agreementID string, status ...ChargeStatus) ([]*Charge, error) {
+func (c *Client) ListCharges(ctx context.Context, agreementID string, status ...ChargeStatus) (_ []*Charge, err error) {
+	ctx, span := vipps.StartSpan(ctx, c.Tracer, vipps.SpanKindClient, "recurring.ListCharges", vipps.AgreementIDAttr(agreementID))
+	defer func() { vipps.EndSpan(span, err) }()
+
 	var query string
 
 	if len(status) > 0 {
@@ -177,8 +263,14 @@ func (c *Client) ListCharges(ctx context.Context, agreementID string, status ...
 }
 
 // CreateAgreement creates an Agreement.
-func (c *Client) CreateAgreement(ctx context.Context, cmd CreateAgreementCommand) (*AgreementReference, error) {
-	endpoint := c.BaseURL + recurringEndpoint
+func (c *Client) CreateAgreement(ctx context.Context, cmd CreateAgreementCommand) (_ *AgreementReference, err error) {
+	ctx, span := vipps.StartSpan(ctx, c.Tracer, vipps.SpanKindClient, "recurring.CreateAgreement")
+	defer func() { vipps.EndSpan(span, err) }()
+
+	if err := c.validate(cmd); err != nil {
+		return nil, err
+	}
+	endpoint := fmt.Sprintf("%s/%s", c.BaseURL, recurringEndpoint)
 	method := http.MethodPost
 	res := AgreementReference{}
 
@@ -196,7 +288,13 @@ func (c *Client) CreateAgreement(ctx context.Context, cmd CreateAgreementCommand
 }
 
 // UpdateAgreement updates an Agreement.
-func (c *Client) UpdateAgreement(ctx context.Context, cmd UpdateAgreementCommand) (AgreementID, error) {
+func (c *Client) UpdateAgreement(ctx context.Context, cmd UpdateAgreementCommand) (_ AgreementID, err error) {
+	ctx, span := vipps.StartSpan(ctx, c.Tracer, vipps.SpanKindClient, "recurring.UpdateAgreement", vipps.AgreementIDAttr(cmd.AgreementID))
+	defer func() { vipps.EndSpan(span, err) }()
+
+	if err := c.validate(cmd); err != nil {
+		return "", err
+	}
 	endpoint := fmt.Sprintf("%s/%s/%s", c.BaseURL, recurringEndpoint, cmd.AgreementID)
 	method := http.MethodPatch
 	res := struct {
@@ -217,12 +315,15 @@ func (c *Client) UpdateAgreement(ctx context.Context, cmd UpdateAgreementCommand
 }
 
 // ListAgreements lists Agreements for a sales unit.
-func (c *Client) ListAgreements(ctx context.Context, status ...AgreementStatus) ([]*Agreement, error) {
+func (c *Client) ListAgreements(ctx context.Context, status ...AgreementStatus) (_ []*Agreement, err error) {
+	ctx, span := vipps.StartSpan(ctx, c.Tracer, vipps.SpanKindClient, "recurring.ListAgreements")
+	defer func() { vipps.EndSpan(span, err) }()
+
 	var query string
 	if len(status) > 0 {
 		query = fmt.Sprintf("?status=%s", status[0])
 	}
-	endpoint := c.BaseURL + recurringEndpoint + query
+	endpoint := fmt.Sprintf("%s/%s%s", c.BaseURL, recurringEndpoint, query)
 	method := http.MethodGet
 	res := make([]*Agreement, 0)
 
@@ -240,7 +341,10 @@ func (c *Client) ListAgreements(ctx context.Context, status ...AgreementStatus)
 }
 
 // GetAgreement gets an Agreement.
-func (c *Client) GetAgreement(ctx context.Context, agreementID string) (*Agreement, error) {
+func (c *Client) GetAgreement(ctx context.Context, agreementID string) (_ *Agreement, err error) {
+	ctx, span := vipps.StartSpan(ctx, c.Tracer, vipps.SpanKindClient, "recurring.GetAgreement", vipps.AgreementIDAttr(agreementID))
+	defer func() { vipps.EndSpan(span, err) }()
+
 	endpoint := fmt.Sprintf("%s/%s/%s", c.BaseURL, recurringEndpoint, agreementID)
 	method := http.MethodGet
 	res := Agreement{}
@@ -257,3 +361,16 @@ func (c *Client) GetAgreement(ctx context.Context, agreementID string) (*Agreeme
 
 	return &res, nil
 }
+
+// validator is implemented by commands that can be validated before they are
+// sent.
+type validator interface {
+	Validate() error
+}
+
+func (c *Client) validate(cmd validator) error {
+	if c.SkipValidation {
+		return nil
+	}
+	return cmd.Validate()
+}
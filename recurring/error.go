@@ -9,7 +9,10 @@ import (
 )
 
 // ErrRecurring represents errors returned from the Vipps Recurring Payments
-// API.
+// API. The v2 API does not document its error codes, so the *vipps.APIError
+// wrapping it is classified by its HTTP status alone, see vipps.NewAPIError.
+// Use the v3 API to tell e.g. vipps.ErrAgreementNotActive apart, as its
+// problem types are documented.
 type ErrRecurring []RecurringAPIError
 
 // RecurringAPIError represents a single error returned from the Vipps
@@ -32,17 +35,27 @@ func (e ErrRecurring) Error() string {
 	return strings.Join(s, " ")
 }
 
+// ErrorCodes returns the error codes of e.
+func (e ErrRecurring) ErrorCodes() []string {
+	codes := make([]string, len(e))
+	for i, e := range e {
+		codes[i] = e.Code
+	}
+	return codes
+}
+
 func wrapErr(err error) error {
 	if err, ok := err.(internal.HTTPError); ok {
 		var wrappedErr ErrRecurring
 		unmarshalErr := json.Unmarshal(err.Body, &wrappedErr)
 		if unmarshalErr != nil {
-			return vipps.ErrUnexpectedResponse{
-				Body:   err.Body,
-				Status: err.Status,
-			}
+			return vipps.NewAPIError(err.Status, err.RequestID, nil, vipps.ErrUnexpectedResponse{
+				Body:      err.Body,
+				Status:    err.Status,
+				HTTPError: err,
+			})
 		}
-		return wrappedErr
+		return vipps.NewAPIError(err.Status, err.RequestID, nil, wrappedErr)
 	}
 	return err
 }
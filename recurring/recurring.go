@@ -1,8 +1,13 @@
 // Package recurring provides a Client and supporting types to consume and interact
 // with the Vipps Recurring Payments API
+//
+// This package targets v2 of the API, which Vipps is retiring. New
+// integrations should use package github.com/torfjor/go-vipps/recurring/v3,
+// which can also convert the commands of this package.
 package recurring
 
 import (
+	"github.com/torfjor/go-vipps"
 	"time"
 )
 
@@ -44,14 +49,14 @@ const (
 
 // Campaign represents a Vipps Recurring Payments campaign.
 type Campaign struct {
-	Price int        `json:"campaignPrice"`
-	End   *time.Time `json:"end"`
+	Price vipps.Money `json:"campaignPrice"`
+	End   *time.Time  `json:"end"`
 }
 
 // InitialCharge represents the initial charge used in a Vipps recurring
 // payment.
 type InitialCharge struct {
-	Amount          int             `json:"amount"`
+	Amount          vipps.Money     `json:"amount"`
 	Currency        Currency        `json:"currency"`
 	Description     string          `json:"description"`
 	TransactionType TransactionType `json:"transactionType"`
@@ -69,7 +74,7 @@ type CreateAgreementCommand struct {
 	IsApp               bool           `json:"isApp"`
 	AgreementURL        string         `json:"merchantAgreementUrl"`
 	RedirectURL         string         `json:"merchantRedirectUrl"`
-	Price               int            `json:"price"`
+	Price               vipps.Money    `json:"price"`
 	ProductName         string         `json:"productName"`
 	ProductDescription  string         `json:"productDescription"`
 }
@@ -102,7 +107,7 @@ type Agreement struct {
 	ID                 string          `json:"id"`
 	Interval           ChargeInterval  `json:"interval"`
 	IntervalCount      int             `json:"intervalCount"`
-	Price              int             `json:"price"`
+	Price              vipps.Money     `json:"price"`
 	ProductName        string          `json:"productName"`
 	ProductDescription string          `json:"productDescription"`
 	Start              *time.Time      `json:"start"`
@@ -114,7 +119,7 @@ type Agreement struct {
 type UpdateAgreementCommand struct {
 	AgreementID        string          `json:"-"`
 	Campaign           *Campaign       `json:"campaign,omitempty"`
-	Price              int             `json:"price,omitempty"`
+	Price              *vipps.Money    `json:"price,omitempty"`
 	ProductName        string          `json:"productName,omitempty"`
 	ProductDescription string          `json:"productDescription,omitempty"`
 	Status             AgreementStatus `json:"status,omitempty"`
@@ -138,8 +143,8 @@ const (
 
 // Charge represents a charge associated with an Agreement.
 type Charge struct {
-	Amount         int          `json:"amount"`
-	AmountRefunded int          `json:"amountRefunded"`
+	Amount         vipps.Money  `json:"amount"`
+	AmountRefunded vipps.Money  `json:"amountRefunded"`
 	Description    string       `json:"description"`
 	Due            time.Time    `json:"due"`
 	ID             string       `json:"id"`
@@ -151,13 +156,13 @@ type Charge struct {
 // CreateChargeCommand represents the command used to created a Charge.
 type CreateChargeCommand struct {
 	IdempotencyKey
-	AgreementID string   `json:"-"`
-	Amount      int      `json:"amount"`
-	Currency    Currency `json:"currency,omitempty"`
-	Description string   `json:"description"`
-	Due         DueDate  `json:"due"`
-	RetryDays   int      `json:"retryDays,omitempty"`
-	OrderID     string   `json:"orderId,omitempty"`
+	AgreementID string      `json:"-"`
+	Amount      vipps.Money `json:"amount"`
+	Currency    Currency    `json:"currency,omitempty"`
+	Description string      `json:"description"`
+	Due         DueDate     `json:"due"`
+	RetryDays   int         `json:"retryDays,omitempty"`
+	OrderID     string      `json:"orderId,omitempty"`
 }
 
 // DueDate is the date at which a charge is due to be paid
@@ -173,6 +178,8 @@ func (d DueDate) MarshalJSON() ([]byte, error) {
 // ChargeReference is a reference to a Charge.
 type ChargeReference struct {
 	ChargeID string `json:"chargeId"`
+	// IdempotencyKey is the key that the request was sent with.
+	IdempotencyKey string `json:"-"`
 }
 
 // ChargeIdentifier identifies a Charge.
@@ -181,15 +188,16 @@ type ChargeIdentifier struct {
 	ChargeID    string `json:"-"`
 }
 
-// IdempotencyKey is used to make idempotent retries in mutating commands.
+// IdempotencyKey is used to make idempotent retries in mutating commands. If
+// empty, it is generated by the Client.
 type IdempotencyKey = string
 
 // RefundChargeCommand represents the command used to refund a Charge.
 type RefundChargeCommand struct {
 	ChargeIdentifier `json:"-"`
 	IdempotencyKey   `json:"-"`
-	Amount           int    `json:"amount"`
-	Description      string `json:"description"`
+	Amount           vipps.Money `json:"amount"`
+	Description      string      `json:"description"`
 }
 
 // CaptureChargeCommand represents the command used to capture a Charge.
@@ -0,0 +1,414 @@
+package recurring
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-kit/kit/log"
+	"github.com/torfjor/go-vipps"
+	"github.com/torfjor/go-vipps/auth"
+	"github.com/torfjor/go-vipps/internal"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+const (
+	recurringEndpoint = "recurring/v3/agreements"
+)
+
+type Doer interface {
+	Do(req *http.Request, v interface{}) error
+	NewRequest(ctx context.Context, method, endpoint string, body interface{}) (*http.Request, error)
+}
+
+// Client represents an API client for the Vipps recurring payments API v3.
+type Client struct {
+	BaseURL   string
+	APIClient Doer
+	// SkipValidation disables the validation of commands before they are
+	// sent.
+	SkipValidation bool
+	// Tracer, if set, traces every call on the Client.
+	Tracer vipps.Tracer
+	// IdempotencyStore, if set, remembers the idempotency keys generated for
+	// commands that have none.
+	IdempotencyStore vipps.IdempotencyStore
+}
+
+// NewClient returns a configured Client. It panics if config has no
+// HTTPClient, or an unknown Environment and no BaseURL. An empty Environment
+// means production. Use New to get an error instead.
+func NewClient(config vipps.ClientConfig) *Client {
+	if config.HTTPClient == nil {
+		panic("config.HTTPClient cannot be nil")
+	}
+	c, err := newClient(config)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// New returns a Client configured with opts, or an error if the configuration
+// is invalid. Unless it is given a HTTPClient, the Client authenticates with
+// the Credentials, see auth.NewFromConfig.
+func New(opts ...vipps.Option) (*Client, error) {
+	config, err := vipps.NewConfig(opts...)
+	if err != nil {
+		return nil, err
+	}
+	if config.HTTPClient == nil {
+		if config.HTTPClient, err = auth.NewFromConfig(config); err != nil {
+			return nil, err
+		}
+	}
+	return newClient(config)
+}
+
+func newClient(config vipps.ClientConfig) (*Client, error) {
+	var logger log.Logger
+
+	baseUrl, err := config.APIBaseURL()
+	if err != nil {
+		return nil, err
+	}
+
+	if config.Logger == nil {
+		logger = log.NewNopLogger()
+	} else {
+		logger = config.Logger
+	}
+
+	return &Client{
+		BaseURL: baseUrl,
+		APIClient: &internal.APIClient{
+			L: logger,
+			C: config.Doer(),
+			R: (*internal.RetryPolicy)(config.RetryPolicy),
+			H: config.Headers(),
+		},
+		SkipValidation:   config.SkipValidation,
+		Tracer:           config.Tracer,
+		IdempotencyStore: config.IdempotencyStore,
+	}, nil
+}
+
+// CreateAgreement creates an Agreement.
+func (c *Client) CreateAgreement(ctx context.Context, cmd CreateAgreementCommand) (_ *AgreementReference, err error) {
+	ctx, span := vipps.StartSpan(ctx, c.Tracer, vipps.SpanKindClient, "recurring.v3.CreateAgreement")
+	defer func() { vipps.EndSpan(span, err) }()
+
+	if err := c.validate(cmd); err != nil {
+		return nil, err
+	}
+	key, done, err := internal.IdempotencyKey(ctx, internal.Logger(c.APIClient), c.IdempotencyStore,
+		"recurring.v3.CreateAgreement/"+internal.Fingerprint(cmd), cmd.IdempotencyKey)
+	if err != nil {
+		return nil, err
+	}
+	endpoint := fmt.Sprintf("%s/%s", c.BaseURL, recurringEndpoint)
+	method := http.MethodPost
+	res := AgreementReference{}
+
+	req, err := c.APIClient.NewRequest(ctx, method, endpoint, cmd)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Idempotency-Key", key)
+
+	err = c.APIClient.Do(req, &res)
+	done(err)
+	if err != nil {
+		return nil, wrapErr(err)
+	}
+	res.IdempotencyKey = key
+
+	return &res, nil
+}
+
+// UpdateAgreement updates an Agreement.
+func (c *Client) UpdateAgreement(ctx context.Context, cmd UpdateAgreementCommand) (err error) {
+	ctx, span := vipps.StartSpan(ctx, c.Tracer, vipps.SpanKindClient, "recurring.v3.UpdateAgreement", vipps.AgreementIDAttr(cmd.AgreementID))
+	defer func() { vipps.EndSpan(span, err) }()
+
+	if err := c.validate(cmd); err != nil {
+		return err
+	}
+	key, done, err := internal.IdempotencyKey(ctx, internal.Logger(c.APIClient), c.IdempotencyStore,
+		"recurring.v3.UpdateAgreement/"+cmd.AgreementID+"/"+internal.Fingerprint(cmd), cmd.IdempotencyKey)
+	if err != nil {
+		return err
+	}
+	endpoint := fmt.Sprintf("%s/%s/%s", c.BaseURL, recurringEndpoint, cmd.AgreementID)
+	method := http.MethodPatch
+
+	req, err := c.APIClient.NewRequest(ctx, method, endpoint, cmd)
+	if err != nil {
+		return err
+	}
+	req.Header.Add("Idempotency-Key", key)
+
+	err = c.APIClient.Do(req, nil)
+	done(err)
+	if err != nil {
+		return wrapErr(err)
+	}
+
+	return nil
+}
+
+// GetAgreement gets an Agreement.
+func (c *Client) GetAgreement(ctx context.Context, agreementID string) (_ *Agreement, err error) {
+	ctx, span := vipps.StartSpan(ctx, c.Tracer, vipps.SpanKindClient, "recurring.v3.GetAgreement", vipps.AgreementIDAttr(agreementID))
+	defer func() { vipps.EndSpan(span, err) }()
+
+	endpoint := fmt.Sprintf("%s/%s/%s", c.BaseURL, recurringEndpoint, agreementID)
+	method := http.MethodGet
+	res := Agreement{}
+
+	req, err := c.APIClient.NewRequest(ctx, method, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.APIClient.Do(req, &res)
+	if err != nil {
+		return nil, wrapErr(err)
+	}
+
+	return &res, nil
+}
+
+// ListAgreements lists one page of Agreements for a sales unit.
+func (c *Client) ListAgreements(ctx context.Context, opts ListAgreementsOptions) (_ []*Agreement, err error) {
+	ctx, span := vipps.StartSpan(ctx, c.Tracer, vipps.SpanKindClient, "recurring.v3.ListAgreements")
+	defer func() { vipps.EndSpan(span, err) }()
+
+	q := url.Values{}
+	if opts.Status != "" {
+		q.Set("status", string(opts.Status))
+	}
+	if !opts.CreatedAfter.IsZero() {
+		q.Set("createdAfter", strconv.FormatInt(opts.CreatedAfter.Unix(), 10))
+	}
+	setPage(q, opts.PageNumber, opts.PageSize)
+
+	endpoint := fmt.Sprintf("%s/%s%s", c.BaseURL, recurringEndpoint, encodeQuery(q))
+	method := http.MethodGet
+	res := make([]*Agreement, 0)
+
+	req, err := c.APIClient.NewRequest(ctx, method, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.APIClient.Do(req, &res)
+	if err != nil {
+		return nil, wrapErr(err)
+	}
+
+	return res, nil
+}
+
+// CreateCharge creates a Charge for an Agreement.
+func (c *Client) CreateCharge(ctx context.Context, cmd CreateChargeCommand) (_ *ChargeReference, err error) {
+	ctx, span := vipps.StartSpan(ctx, c.Tracer, vipps.SpanKindClient, "recurring.v3.CreateCharge", vipps.AgreementIDAttr(cmd.AgreementID))
+	defer func() { vipps.EndSpan(span, err) }()
+
+	if err := c.validate(cmd); err != nil {
+		return nil, err
+	}
+	key, done, err := internal.IdempotencyKey(ctx, internal.Logger(c.APIClient), c.IdempotencyStore,
+		fmt.Sprintf("recurring.v3.CreateCharge/%s/%s/%d/%s", cmd.AgreementID, cmd.Due.Format("2006-01-02"), cmd.Amount.Minor, cmd.OrderID), cmd.IdempotencyKey)
+	if err != nil {
+		return nil, err
+	}
+	endpoint := fmt.Sprintf("%s/%s/%s/charges", c.BaseURL, recurringEndpoint, cmd.AgreementID)
+	method := http.MethodPost
+	res := ChargeReference{}
+
+	req, err := c.APIClient.NewRequest(ctx, method, endpoint, cmd)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Idempotency-Key", key)
+
+	err = c.APIClient.Do(req, &res)
+	done(err)
+	if err != nil {
+		return nil, wrapErr(err)
+	}
+	res.IdempotencyKey = key
+
+	return &res, nil
+}
+
+// GetCharge gets a Charge associated with an Agreement.
+func (c *Client) GetCharge(ctx context.Context, id ChargeIdentifier) (_ *Charge, err error) {
+	ctx, span := vipps.StartSpan(ctx, c.Tracer, vipps.SpanKindClient, "recurring.v3.GetCharge", vipps.AgreementIDAttr(id.AgreementID), vipps.ChargeIDAttr(id.ChargeID))
+	defer func() { vipps.EndSpan(span, err) }()
+
+	endpoint := fmt.Sprintf("%s/%s/%s/charges/%s", c.BaseURL, recurringEndpoint, id.AgreementID, id.ChargeID)
+	method := http.MethodGet
+	res := Charge{}
+
+	req, err := c.APIClient.NewRequest(ctx, method, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.APIClient.Do(req, &res)
+	if err != nil {
+		return nil, wrapErr(err)
+	}
+
+	return &res, nil
+}
+
+// ListCharges lists one page of Charges associated with an Agreement.
+func (c *Client) ListCharges(ctx context.Context, agreementID string, opts ListChargesOptions) (_ []*Charge, err error) {
+	ctx, span := vipps.StartSpan(ctx, c.Tracer, vipps.SpanKindClient, "recurring.v3.ListCharges", vipps.AgreementIDAttr(agreementID))
+	defer func() { vipps.EndSpan(span, err) }()
+
+	q := url.Values{}
+	if opts.Status != "" {
+		q.Set("status", string(opts.Status))
+	}
+	setPage(q, opts.PageNumber, opts.PageSize)
+
+	endpoint := fmt.Sprintf("%s/%s/%s/charges%s", c.BaseURL, recurringEndpoint, agreementID, encodeQuery(q))
+	method := http.MethodGet
+	res := make([]*Charge, 0)
+
+	req, err := c.APIClient.NewRequest(ctx, method, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.APIClient.Do(req, &res)
+	if err != nil {
+		return nil, wrapErr(err)
+	}
+
+	return res, nil
+}
+
+// CaptureCharge captures reserved amounts on a Charge.
+func (c *Client) CaptureCharge(ctx context.Context, cmd CaptureChargeCommand) (err error) {
+	ctx, span := vipps.StartSpan(ctx, c.Tracer, vipps.SpanKindClient, "recurring.v3.CaptureCharge", vipps.AgreementIDAttr(cmd.AgreementID), vipps.ChargeIDAttr(cmd.ChargeID))
+	defer func() { vipps.EndSpan(span, err) }()
+
+	if err := c.validate(cmd); err != nil {
+		return err
+	}
+	key, done, err := internal.IdempotencyKey(ctx, internal.Logger(c.APIClient), c.IdempotencyStore,
+		fmt.Sprintf("recurring.v3.CaptureCharge/%s/%s/%d", cmd.AgreementID, cmd.ChargeID, cmd.Amount.Minor), cmd.IdempotencyKey)
+	if err != nil {
+		return err
+	}
+	endpoint := fmt.Sprintf("%s/%s/%s/charges/%s/capture", c.BaseURL, recurringEndpoint, cmd.AgreementID, cmd.ChargeID)
+	method := http.MethodPost
+
+	req, err := c.APIClient.NewRequest(ctx, method, endpoint, cmd)
+	if err != nil {
+		return err
+	}
+	req.Header.Add("Idempotency-Key", key)
+
+	err = c.APIClient.Do(req, nil)
+	done(err)
+	if err != nil {
+		return wrapErr(err)
+	}
+
+	return nil
+}
+
+// RefundCharge refunds already captured amounts on a Charge.
+func (c *Client) RefundCharge(ctx context.Context, cmd RefundChargeCommand) (err error) {
+	ctx, span := vipps.StartSpan(ctx, c.Tracer, vipps.SpanKindClient, "recurring.v3.RefundCharge", vipps.AgreementIDAttr(cmd.AgreementID), vipps.ChargeIDAttr(cmd.ChargeID))
+	defer func() { vipps.EndSpan(span, err) }()
+
+	if err := c.validate(cmd); err != nil {
+		return err
+	}
+	key, done, err := internal.IdempotencyKey(ctx, internal.Logger(c.APIClient), c.IdempotencyStore,
+		fmt.Sprintf("recurring.v3.RefundCharge/%s/%s/%d", cmd.AgreementID, cmd.ChargeID, cmd.Amount.Minor), cmd.IdempotencyKey)
+	if err != nil {
+		return err
+	}
+	endpoint := fmt.Sprintf("%s/%s/%s/charges/%s/refund", c.BaseURL, recurringEndpoint, cmd.AgreementID, cmd.ChargeID)
+	method := http.MethodPost
+
+	req, err := c.APIClient.NewRequest(ctx, method, endpoint, cmd)
+	if err != nil {
+		return err
+	}
+	req.Header.Add("Idempotency-Key", key)
+
+	err = c.APIClient.Do(req, nil)
+	done(err)
+	if err != nil {
+		return wrapErr(err)
+	}
+
+	return nil
+}
+
+// CancelCharge cancels a Charge. Will error for Charges that are not in a
+// cancellable state.
+func (c *Client) CancelCharge(ctx context.Context, cmd CancelChargeCommand) (err error) {
+	ctx, span := vipps.StartSpan(ctx, c.Tracer, vipps.SpanKindClient, "recurring.v3.CancelCharge", vipps.AgreementIDAttr(cmd.AgreementID), vipps.ChargeIDAttr(cmd.ChargeID))
+	defer func() { vipps.EndSpan(span, err) }()
+
+	key, done, err := internal.IdempotencyKey(ctx, internal.Logger(c.APIClient), c.IdempotencyStore,
+		fmt.Sprintf("recurring.v3.CancelCharge/%s/%s", cmd.AgreementID, cmd.ChargeID), cmd.IdempotencyKey)
+	if err != nil {
+		return err
+	}
+	endpoint := fmt.Sprintf("%s/%s/%s/charges/%s", c.BaseURL, recurringEndpoint, cmd.AgreementID, cmd.ChargeID)
+	method := http.MethodDelete
+
+	req, err := c.APIClient.NewRequest(ctx, method, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Add("Idempotency-Key", key)
+
+	err = c.APIClient.Do(req, nil)
+	done(err)
+	if err != nil {
+		return wrapCancelErr(err)
+	}
+
+	return nil
+}
+
+func setPage(q url.Values, number, size int) {
+	if number > 0 {
+		q.Set("pageNumber", strconv.Itoa(number))
+	}
+	if size > 0 {
+		q.Set("pageSize", strconv.Itoa(size))
+	}
+}
+
+func encodeQuery(q url.Values) string {
+	if len(q) == 0 {
+		return ""
+	}
+	return "?" + q.Encode()
+}
+
+// validator is implemented by commands that can be validated before they are
+// sent.
+type validator interface {
+	Validate() error
+}
+
+func (c *Client) validate(cmd validator) error {
+	if c.SkipValidation {
+		return nil
+	}
+	return cmd.Validate()
+}
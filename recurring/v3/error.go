@@ -0,0 +1,58 @@
+package recurring
+
+import (
+	"errors"
+	"github.com/torfjor/go-vipps"
+	"github.com/torfjor/go-vipps/internal"
+)
+
+// ErrRecurring represents an error returned from the Vipps Recurring Payments
+// API v3, in the problem details format of RFC 7807.
+type ErrRecurring struct {
+	internal.Problem
+}
+
+// FieldError represents a problem with a single field of a request.
+type FieldError = internal.ProblemField
+
+// errorKinds maps the problem types documented for the Recurring API v3, at
+// https://developer.vippsmobilepay.com/docs/APIs/recurring-api/recurring-api-problems,
+// to the errors they are classified as.
+var errorKinds = map[string]error{
+	"agreement-not-found":      vipps.ErrNotFound,
+	"charge-not-found":         vipps.ErrNotFound,
+	"agreement-not-active":     vipps.ErrAgreementNotActive,
+	"illegal-agreement-update": vipps.ErrAgreementNotActive,
+	"charge-not-cancellable":   vipps.ErrChargeNotCancellable,
+}
+
+// codeIllegalChargeStatus is the problem type of operations that the status of
+// a Charge does not allow.
+const codeIllegalChargeStatus = "illegal-charge-status"
+
+func wrapErr(err error) error {
+	if err, ok := err.(internal.HTTPError); ok {
+		problem, ok := internal.ParseProblem(err.Body)
+		if !ok {
+			return vipps.NewAPIError(err.Status, err.RequestID, nil, vipps.ErrUnexpectedResponse{
+				Body:      err.Body,
+				Status:    err.Status,
+				HTTPError: err,
+			})
+		}
+		return vipps.NewAPIError(err.Status, err.RequestID, errorKinds[problem.Code()], ErrRecurring{problem})
+	}
+	return err
+}
+
+// wrapCancelErr is wrapErr for CancelCharge, where an illegal charge status
+// means that the Charge is not cancellable.
+func wrapCancelErr(err error) error {
+	err = wrapErr(err)
+	var apiErr *vipps.APIError
+	var problem ErrRecurring
+	if errors.As(err, &apiErr) && errors.As(err, &problem) && problem.Code() == codeIllegalChargeStatus {
+		apiErr.Kind = vipps.ErrChargeNotCancellable
+	}
+	return err
+}
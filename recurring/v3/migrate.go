@@ -0,0 +1,92 @@
+package recurring
+
+import (
+	v2 "github.com/torfjor/go-vipps/recurring"
+	"strings"
+)
+
+// CreateAgreementFromV2 converts a v2 CreateAgreementCommand to its v3
+// counterpart. The price becomes a LEGACY Pricing, the interval an Interval,
+// and a campaign a PRICE_CAMPAIGN. An 8 digit customer phone number is
+// prefixed with the Norwegian country code.
+func CreateAgreementFromV2(cmd v2.CreateAgreementCommand, idempotencyKey IdempotencyKey) CreateAgreementCommand {
+	res := CreateAgreementCommand{
+		IdempotencyKey: idempotencyKey,
+		Campaign:       campaignFromV2(cmd.Campaign),
+		Interval: Interval{
+			Unit:  IntervalUnit(cmd.Interval),
+			Count: cmd.IntervalCount,
+		},
+		IsApp:              cmd.IsApp,
+		AgreementURL:       cmd.AgreementURL,
+		RedirectURL:        cmd.RedirectURL,
+		PhoneNumber:        phoneNumberFromV2(cmd.CustomerPhoneNumber),
+		Pricing:            Pricing{Type: PricingTypeLegacy, Currency: Currency(cmd.Currency), Amount: cmd.Price},
+		ProductName:        cmd.ProductName,
+		ProductDescription: cmd.ProductDescription,
+	}
+	if res.Pricing.Currency == "" {
+		res.Pricing.Currency = CurrencyNOK
+	}
+	if ic := cmd.InitialCharge; ic.Amount.Minor > 0 {
+		res.InitialCharge = &InitialCharge{
+			Amount:          ic.Amount,
+			Description:     ic.Description,
+			TransactionType: TransactionType(ic.TransactionType),
+			OrderID:         ic.OrderID,
+		}
+	}
+	return res
+}
+
+// UpdateAgreementFromV2 converts a v2 UpdateAgreementCommand to its v3
+// counterpart. Campaigns can not be changed on v3 agreements, so a campaign in
+// cmd is ignored.
+func UpdateAgreementFromV2(cmd v2.UpdateAgreementCommand, idempotencyKey IdempotencyKey) UpdateAgreementCommand {
+	res := UpdateAgreementCommand{
+		IdempotencyKey:     idempotencyKey,
+		AgreementID:        cmd.AgreementID,
+		ProductName:        cmd.ProductName,
+		ProductDescription: cmd.ProductDescription,
+		Status:             AgreementStatus(cmd.Status),
+	}
+	if cmd.Price != nil && !cmd.Price.IsZero() {
+		res.Pricing = &PricingUpdate{Amount: *cmd.Price}
+	}
+	return res
+}
+
+// CreateChargeFromV2 converts a v2 CreateChargeCommand to a v3 RECURRING
+// charge with direct capture, which is what v2 charges are.
+func CreateChargeFromV2(cmd v2.CreateChargeCommand) CreateChargeCommand {
+	return CreateChargeCommand{
+		IdempotencyKey:  cmd.IdempotencyKey,
+		AgreementID:     cmd.AgreementID,
+		Amount:          cmd.Amount,
+		Description:     cmd.Description,
+		Due:             DueDate{cmd.Due.Time},
+		RetryDays:       cmd.RetryDays,
+		TransactionType: TransactionTypeDirectCapture,
+		Type:            ChargeTypeRecurring,
+		OrderID:         cmd.OrderID,
+	}
+}
+
+func campaignFromV2(c *v2.Campaign) *Campaign {
+	if c == nil {
+		return nil
+	}
+	return &Campaign{
+		Type:  CampaignTypePrice,
+		Price: c.Price,
+		End:   c.End,
+	}
+}
+
+func phoneNumberFromV2(n string) string {
+	n = strings.TrimPrefix(n, "+")
+	if len(n) == 8 {
+		return "47" + n
+	}
+	return n
+}
@@ -0,0 +1,429 @@
+// Package recurring provides a Client and supporting types to consume and
+// interact with the Vipps Recurring Payments API v3.
+//
+// Compared to v2, agreements are priced with a Pricing object that is either
+// LEGACY (a fixed amount per interval) or VARIABLE (a suggested maximum the
+// user approves), the charge interval is an Interval object, and campaigns come
+// in several types. Agreements can request user information through Scope,
+// which is made available at UserInfoURL once the agreement is active. Charges
+// can be UNSCHEDULED, and agreements and charges are listed page by page.
+//
+// Code using the v2 package can move over one call at a time: the
+// CreateAgreementFromV2, UpdateAgreementFromV2 and CreateChargeFromV2 functions
+// convert v2 commands to their v3 counterparts.
+package recurring
+
+import (
+	"encoding/json"
+	"github.com/torfjor/go-vipps"
+	"time"
+)
+
+// Currency represents the currency to use for a Vipps recurring payment.
+type Currency string
+
+// List of values that Currency can take.
+const (
+	CurrencyNOK Currency = "NOK"
+)
+
+// TransactionType represents the type of capture used for a payment.
+type TransactionType string
+
+// List of values that TransactionType can take.
+const (
+	TransactionTypeDirectCapture  TransactionType = "DIRECT_CAPTURE"
+	TransactionTypeReserveCapture TransactionType = "RESERVE_CAPTURE"
+)
+
+// PricingType represents how an Agreement is priced.
+type PricingType string
+
+// List of values that PricingType can take.
+const (
+	// PricingTypeLegacy charges a fixed amount per interval.
+	PricingTypeLegacy PricingType = "LEGACY"
+	// PricingTypeVariable lets the user approve a maximum amount per
+	// interval, and the merchant charge any amount up to it.
+	PricingTypeVariable PricingType = "VARIABLE"
+)
+
+// Pricing represents the price of an Agreement. Zero amounts are left out
+// when encoded.
+type Pricing struct {
+	Type     PricingType
+	Currency Currency
+	// Amount is the price per interval for LEGACY pricing.
+	Amount vipps.Money
+	// SuggestedMaxAmount is the maximum amount per interval suggested to the
+	// user for VARIABLE pricing.
+	SuggestedMaxAmount vipps.Money
+	// MaxAmount is the maximum amount per interval approved by the user for
+	// VARIABLE pricing. Only set on Agreements returned by Vipps.
+	MaxAmount vipps.Money
+}
+
+type pricing struct {
+	Type               PricingType  `json:"type"`
+	Currency           Currency     `json:"currency"`
+	Amount             *vipps.Money `json:"amount,omitempty"`
+	SuggestedMaxAmount *vipps.Money `json:"suggestedMaxAmount,omitempty"`
+	MaxAmount          *vipps.Money `json:"maxAmount,omitempty"`
+}
+
+// MarshalJSON satisfies json.Marshaler.
+func (p Pricing) MarshalJSON() ([]byte, error) {
+	return json.Marshal(pricing{
+		Type:               p.Type,
+		Currency:           p.Currency,
+		Amount:             optional(p.Amount),
+		SuggestedMaxAmount: optional(p.SuggestedMaxAmount),
+		MaxAmount:          optional(p.MaxAmount),
+	})
+}
+
+// UnmarshalJSON satisfies json.Unmarshaler.
+func (p *Pricing) UnmarshalJSON(b []byte) error {
+	var res pricing
+	if err := json.Unmarshal(b, &res); err != nil {
+		return err
+	}
+	*p = Pricing{
+		Type:               res.Type,
+		Currency:           res.Currency,
+		Amount:             value(res.Amount),
+		SuggestedMaxAmount: value(res.SuggestedMaxAmount),
+		MaxAmount:          value(res.MaxAmount),
+	}
+	return nil
+}
+
+// LegacyPricing returns a LEGACY Pricing of amount per interval.
+func LegacyPricing(amount vipps.Money) Pricing {
+	return Pricing{Type: PricingTypeLegacy, Currency: CurrencyNOK, Amount: amount}
+}
+
+// VariablePricing returns a VARIABLE Pricing that suggests a maximum of
+// suggestedMaxAmount per interval to the user.
+func VariablePricing(suggestedMaxAmount vipps.Money) Pricing {
+	return Pricing{Type: PricingTypeVariable, Currency: CurrencyNOK, SuggestedMaxAmount: suggestedMaxAmount}
+}
+
+// optional returns m, or nil if it is zero.
+func optional(m vipps.Money) *vipps.Money {
+	if m.IsZero() {
+		return nil
+	}
+	return &m
+}
+
+func value(m *vipps.Money) vipps.Money {
+	if m == nil {
+		return vipps.Money{}
+	}
+	return *m
+}
+
+// IntervalUnit represents the unit of an Interval.
+type IntervalUnit string
+
+// List of values that IntervalUnit can take.
+const (
+	IntervalUnitYear  IntervalUnit = "YEAR"
+	IntervalUnitMonth IntervalUnit = "MONTH"
+	IntervalUnitWeek  IntervalUnit = "WEEK"
+	IntervalUnitDay   IntervalUnit = "DAY"
+)
+
+// Interval represents how often an Agreement is charged, e.g. every 2 weeks.
+type Interval struct {
+	Unit  IntervalUnit `json:"unit"`
+	Count int          `json:"count"`
+	// Text is a human readable description of the interval. Only set on
+	// Agreements returned by Vipps.
+	Text string `json:"text,omitempty"`
+}
+
+// CampaignType represents the type of a Campaign.
+type CampaignType string
+
+// List of values that CampaignType can take.
+const (
+	// CampaignTypePrice charges Price until End.
+	CampaignTypePrice CampaignType = "PRICE_CAMPAIGN"
+	// CampaignTypePeriod charges Price once for the first Period.
+	CampaignTypePeriod CampaignType = "PERIOD_CAMPAIGN"
+	// CampaignTypeEvent charges Price until EventDate, described by
+	// EventText.
+	CampaignTypeEvent CampaignType = "EVENT_CAMPAIGN"
+	// CampaignTypeFullFlex charges Price every Interval until End.
+	CampaignTypeFullFlex CampaignType = "FULL_FLEX_CAMPAIGN"
+)
+
+// Campaign represents a Vipps Recurring Payments campaign. Which fields apply
+// depends on Type.
+type Campaign struct {
+	Type CampaignType `json:"type"`
+	// Price is the campaign price. Must be lower than the Agreement's price.
+	Price     vipps.Money `json:"price"`
+	End       *time.Time  `json:"end,omitempty"`
+	Period    *Interval   `json:"period,omitempty"`
+	EventDate *time.Time  `json:"eventDate,omitempty"`
+	EventText string      `json:"eventText,omitempty"`
+	Interval  *Interval   `json:"interval,omitempty"`
+	// Explanation is a human readable description of the campaign. Only set
+	// on Agreements returned by Vipps.
+	Explanation string `json:"explanation,omitempty"`
+}
+
+// InitialCharge represents the initial charge used in a Vipps recurring
+// payment.
+type InitialCharge struct {
+	Amount          vipps.Money     `json:"amount"`
+	Description     string          `json:"description"`
+	TransactionType TransactionType `json:"transactionType"`
+	OrderID         string          `json:"orderId,omitempty"`
+	ExternalID      string          `json:"externalId,omitempty"`
+}
+
+// IdempotencyKey is used to make idempotent retries in mutating commands. If
+// empty, it is generated by the Client.
+type IdempotencyKey = string
+
+// CreateAgreementCommand represents the command used to create an Agreement
+type CreateAgreementCommand struct {
+	IdempotencyKey `json:"-"`
+	Campaign       *Campaign      `json:"campaign,omitempty"`
+	ExternalID     string         `json:"externalId,omitempty"`
+	InitialCharge  *InitialCharge `json:"initialCharge,omitempty"`
+	Interval       Interval       `json:"interval"`
+	IsApp          bool           `json:"isApp,omitempty"`
+	AgreementURL   string         `json:"merchantAgreementUrl"`
+	RedirectURL    string         `json:"merchantRedirectUrl"`
+	// PhoneNumber is the customer's phone number, with country code and no
+	// `+` prefix, e.g. `4791234567`.
+	PhoneNumber        string  `json:"phoneNumber,omitempty"`
+	Pricing            Pricing `json:"pricing"`
+	ProductName        string  `json:"productName"`
+	ProductDescription string  `json:"productDescription,omitempty"`
+	// Scope is a space separated list of user information to request, e.g.
+	// `name email`. See the scopes in package login.
+	Scope           string `json:"scope,omitempty"`
+	SkipLandingPage bool   `json:"skipLandingPage,omitempty"`
+}
+
+type AgreementID = string
+
+// AgreementReference represents a reference to an agreement associated with a
+// Vipps recurring payment.
+type AgreementReference struct {
+	AgreementID string `json:"agreementId"`
+	// ChargeID is the id of the initial charge, if any.
+	ChargeID string `json:"chargeId"`
+	URL      string `json:"vippsConfirmationUrl"`
+	// IdempotencyKey is the key that the request was sent with.
+	IdempotencyKey string `json:"-"`
+}
+
+// AgreementStatus is the current status of an Agreement.
+type AgreementStatus string
+
+// List of values that AgreementStatus can take.
+const (
+	AgreementStatusPending AgreementStatus = "PENDING"
+	AgreementStatusActive  AgreementStatus = "ACTIVE"
+	AgreementStatusStopped AgreementStatus = "STOPPED"
+	AgreementStatusExpired AgreementStatus = "EXPIRED"
+)
+
+// Agreement represents an agreement associated with a Vipps recurring payment.
+type Agreement struct {
+	Campaign           *Campaign       `json:"campaign"`
+	ExternalID         string          `json:"externalId"`
+	ID                 string          `json:"id"`
+	Interval           Interval        `json:"interval"`
+	AgreementURL       string          `json:"merchantAgreementUrl"`
+	RedirectURL        string          `json:"merchantRedirectUrl"`
+	Pricing            Pricing         `json:"pricing"`
+	ProductName        string          `json:"productName"`
+	ProductDescription string          `json:"productDescription"`
+	Start              *time.Time      `json:"start"`
+	Stop               *time.Time      `json:"stop"`
+	Status             AgreementStatus `json:"status"`
+	// Sub identifies the user, if user information was requested with Scope.
+	Sub string `json:"sub"`
+	// UserInfoURL is where the user information requested with Scope can be
+	// fetched.
+	UserInfoURL string `json:"userinfoUrl"`
+}
+
+// PricingUpdate represents a change of price for an Agreement. Zero amounts
+// are left unchanged.
+type PricingUpdate struct {
+	Amount             vipps.Money
+	SuggestedMaxAmount vipps.Money
+}
+
+// MarshalJSON satisfies json.Marshaler.
+func (p PricingUpdate) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Amount             *vipps.Money `json:"amount,omitempty"`
+		SuggestedMaxAmount *vipps.Money `json:"suggestedMaxAmount,omitempty"`
+	}{optional(p.Amount), optional(p.SuggestedMaxAmount)})
+}
+
+// UpdateAgreementCommand represents the command used to update an Agreement
+type UpdateAgreementCommand struct {
+	IdempotencyKey     `json:"-"`
+	AgreementID        string          `json:"-"`
+	ExternalID         string          `json:"externalId,omitempty"`
+	AgreementURL       string          `json:"merchantAgreementUrl,omitempty"`
+	RedirectURL        string          `json:"merchantRedirectUrl,omitempty"`
+	Pricing            *PricingUpdate  `json:"pricing,omitempty"`
+	ProductName        string          `json:"productName,omitempty"`
+	ProductDescription string          `json:"productDescription,omitempty"`
+	Status             AgreementStatus `json:"status,omitempty"`
+}
+
+// ListAgreementsOptions filters and pages the Agreements returned by
+// Client.ListAgreements.
+type ListAgreementsOptions struct {
+	Status       AgreementStatus
+	CreatedAfter time.Time
+	// PageNumber is the 1-based page to return. Defaults to 1.
+	PageNumber int
+	// PageSize is the number of Agreements per page.
+	PageSize int
+}
+
+// ChargeType represents the type of charge used for a transaction.
+type ChargeType string
+
+// List of values that ChargeType can take.
+const (
+	ChargeTypeInitial     ChargeType = "INITIAL"
+	ChargeTypeRecurring   ChargeType = "RECURRING"
+	ChargeTypeUnscheduled ChargeType = "UNSCHEDULED"
+)
+
+// ChargeStatus represents the current status for a Charge.
+type ChargeStatus string
+
+// List of values that ChargeStatus can take.
+const (
+	ChargeStatusPending           ChargeStatus = "PENDING"
+	ChargeStatusDue               ChargeStatus = "DUE"
+	ChargeStatusReserved          ChargeStatus = "RESERVED"
+	ChargeStatusCharged           ChargeStatus = "CHARGED"
+	ChargeStatusPartiallyCaptured ChargeStatus = "PARTIALLY_CAPTURED"
+	ChargeStatusFailed            ChargeStatus = "FAILED"
+	ChargeStatusCancelled         ChargeStatus = "CANCELLED"
+	ChargeStatusPartiallyRefunded ChargeStatus = "PARTIALLY_REFUNDED"
+	ChargeStatusRefunded          ChargeStatus = "REFUNDED"
+	ChargeStatusProcessing        ChargeStatus = "PROCESSING"
+)
+
+// ChargeSummary represents the captured, refunded and cancelled amounts of a
+// Charge.
+type ChargeSummary struct {
+	Captured  vipps.Money `json:"captured"`
+	Refunded  vipps.Money `json:"refunded"`
+	Cancelled vipps.Money `json:"cancelled"`
+}
+
+// ChargeEvent represents an operation in the history of a Charge.
+type ChargeEvent struct {
+	Occurred       time.Time   `json:"occurred"`
+	Event          string      `json:"event"`
+	Amount         vipps.Money `json:"amount"`
+	IdempotencyKey string      `json:"idempotencyKey"`
+	Success        bool        `json:"success"`
+}
+
+// Charge represents a charge associated with an Agreement.
+type Charge struct {
+	Amount          vipps.Money     `json:"amount"`
+	Currency        Currency        `json:"currency"`
+	Description     string          `json:"description"`
+	Due             time.Time       `json:"due"`
+	ExternalID      string          `json:"externalId"`
+	History         []ChargeEvent   `json:"history"`
+	ID              string          `json:"id"`
+	RetryDays       int             `json:"retryDays"`
+	Status          ChargeStatus    `json:"status"`
+	Summary         ChargeSummary   `json:"summary"`
+	TransactionType TransactionType `json:"transactionType"`
+	Type            ChargeType      `json:"type"`
+}
+
+// CreateChargeCommand represents the command used to created a Charge.
+type CreateChargeCommand struct {
+	IdempotencyKey  `json:"-"`
+	AgreementID     string          `json:"-"`
+	Amount          vipps.Money     `json:"amount"`
+	Description     string          `json:"description"`
+	Due             DueDate         `json:"due"`
+	RetryDays       int             `json:"retryDays"`
+	TransactionType TransactionType `json:"transactionType"`
+	// Type is either ChargeTypeRecurring, the default, or
+	// ChargeTypeUnscheduled for charges outside the agreement's interval.
+	Type       ChargeType `json:"type,omitempty"`
+	OrderID    string     `json:"orderId,omitempty"`
+	ExternalID string     `json:"externalId,omitempty"`
+}
+
+// DueDate is the date at which a charge is due to be paid
+type DueDate struct {
+	time.Time
+}
+
+func (d DueDate) MarshalJSON() ([]byte, error) {
+	layout := "2006-01-02"
+	return []byte(`"` + d.Time.Format(layout) + `"`), nil
+}
+
+// ChargeReference is a reference to a Charge.
+type ChargeReference struct {
+	ChargeID string `json:"chargeId"`
+	// IdempotencyKey is the key that the request was sent with.
+	IdempotencyKey string `json:"-"`
+}
+
+// ChargeIdentifier identifies a Charge.
+type ChargeIdentifier struct {
+	AgreementID string `json:"-"`
+	ChargeID    string `json:"-"`
+}
+
+// ListChargesOptions filters and pages the Charges returned by
+// Client.ListCharges.
+type ListChargesOptions struct {
+	Status ChargeStatus
+	// PageNumber is the 1-based page to return. Defaults to 1.
+	PageNumber int
+	// PageSize is the number of Charges per page.
+	PageSize int
+}
+
+// CaptureChargeCommand represents the command used to capture a reserved
+// Charge, in full or in part.
+type CaptureChargeCommand struct {
+	ChargeIdentifier `json:"-"`
+	IdempotencyKey   `json:"-"`
+	Amount           vipps.Money `json:"amount"`
+	Description      string      `json:"description"`
+}
+
+// RefundChargeCommand represents the command used to refund a Charge.
+type RefundChargeCommand struct {
+	ChargeIdentifier `json:"-"`
+	IdempotencyKey   `json:"-"`
+	Amount           vipps.Money `json:"amount"`
+	Description      string      `json:"description"`
+}
+
+// CancelChargeCommand represents the command used to cancel a Charge.
+type CancelChargeCommand struct {
+	ChargeIdentifier
+	IdempotencyKey
+}
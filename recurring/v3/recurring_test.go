@@ -0,0 +1,55 @@
+package recurring
+
+import (
+	"encoding/json"
+	"github.com/torfjor/go-vipps"
+	"testing"
+)
+
+func TestPricingJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		pricing Pricing
+		want    string
+	}{
+		{"legacy", LegacyPricing(vipps.Ore(9900)), `{"type":"LEGACY","currency":"NOK","amount":9900}`},
+		{"variable", VariablePricing(vipps.Ore(50000)), `{"type":"VARIABLE","currency":"NOK","suggestedMaxAmount":50000}`},
+		{"approved", Pricing{Type: PricingTypeVariable, Currency: CurrencyNOK, SuggestedMaxAmount: vipps.Ore(50000), MaxAmount: vipps.Ore(40000)},
+			`{"type":"VARIABLE","currency":"NOK","suggestedMaxAmount":50000,"maxAmount":40000}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := json.Marshal(tt.pricing)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != tt.want {
+				t.Errorf("Marshal = %s, want %s", b, tt.want)
+			}
+			var got Pricing
+			if err := json.Unmarshal(b, &got); err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.pricing {
+				t.Errorf("Unmarshal = %+v, want %+v", got, tt.pricing)
+			}
+		})
+	}
+}
+
+func TestCommandAmountJSON(t *testing.T) {
+	b, err := json.Marshal(CaptureChargeCommand{Amount: vipps.Ore(4900), Description: "Capture"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"amount":4900,"description":"Capture"}`; string(b) != want {
+		t.Errorf("Marshal = %s, want %s", b, want)
+	}
+	b, err = json.Marshal(UpdateAgreementCommand{Pricing: &PricingUpdate{Amount: vipps.Ore(100)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"pricing":{"amount":100}}`; string(b) != want {
+		t.Errorf("Marshal = %s, want %s", b, want)
+	}
+}
@@ -0,0 +1,118 @@
+package recurring
+
+import (
+	"github.com/torfjor/go-vipps"
+	"github.com/torfjor/go-vipps/internal"
+	"strings"
+	"time"
+)
+
+// Validate checks cmd against the rules documented for the Recurring API. It
+// returns a *vipps.ValidationError listing every invalid field.
+func (cmd CreateAgreementCommand) Validate() error {
+	var e vipps.ValidationError
+	checkPricing(&e, cmd.Pricing)
+	internal.CheckOneOf(&e, "interval.unit", string(cmd.Interval.Unit),
+		string(IntervalUnitYear), string(IntervalUnitMonth), string(IntervalUnitWeek), string(IntervalUnitDay))
+	internal.CheckIntervalCount(&e, "interval.count", cmd.Interval.Count)
+	if n := cmd.PhoneNumber; n != "" {
+		e.Check(strings.HasPrefix(n, "47") && internal.ValidMobileNumber(n[2:]), "phoneNumber",
+			"must be a Norwegian mobile number with country code, e.g. 4791234567")
+	}
+	e.Check(internal.IsHTTPS(cmd.AgreementURL), "merchantAgreementUrl", "must be an https URL")
+	e.Check(cmd.RedirectURL != "", "merchantRedirectUrl", "is required")
+	e.Check(cmd.IsApp || cmd.RedirectURL == "" || internal.IsHTTPS(cmd.RedirectURL), "merchantRedirectUrl", "must be an https URL")
+	internal.CheckProduct(&e, cmd.ProductName, cmd.ProductDescription, true)
+	if c := cmd.Campaign; c != nil {
+		e.Check(c.Price.Minor >= 0, "campaign.price", "cannot be negative")
+		if cmd.Pricing.Type == PricingTypeLegacy {
+			e.Check(c.Price.Minor < cmd.Pricing.Amount.Minor, "campaign.price", "must be lower than pricing.amount")
+		}
+	}
+	if ic := cmd.InitialCharge; ic != nil {
+		e.Check(ic.Amount.Minor > 0, "initialCharge.amount", "must be positive")
+		internal.CheckChargeDescription(&e, "initialCharge.description", ic.Description)
+		checkTransactionType(&e, "initialCharge.transactionType", ic.TransactionType)
+		internal.CheckOrderID(&e, "initialCharge.orderId", ic.OrderID)
+	}
+	return e.Err()
+}
+
+// Validate checks cmd against the rules documented for the Recurring API. It
+// returns a *vipps.ValidationError listing every invalid field.
+func (cmd UpdateAgreementCommand) Validate() error {
+	var e vipps.ValidationError
+	e.Check(cmd.AgreementID != "", "agreementId", "is required")
+	e.Check(cmd.AgreementURL == "" || internal.IsHTTPS(cmd.AgreementURL), "merchantAgreementUrl", "must be an https URL")
+	e.Check(cmd.RedirectURL == "" || internal.IsHTTPS(cmd.RedirectURL), "merchantRedirectUrl", "must be an https URL")
+	if p := cmd.Pricing; p != nil {
+		e.Check(p.Amount.Minor >= 0, "pricing.amount", "cannot be negative")
+		e.Check(p.SuggestedMaxAmount.Minor >= 0, "pricing.suggestedMaxAmount", "cannot be negative")
+	}
+	internal.CheckProduct(&e, cmd.ProductName, cmd.ProductDescription, false)
+	e.Check(cmd.Status == "" || cmd.Status == AgreementStatusStopped, "status", "can only be changed to STOPPED")
+	return e.Err()
+}
+
+// Validate checks cmd against the rules documented for the Recurring API, as
+// of the current time. It returns a *vipps.ValidationError listing every
+// invalid field. The due date of UNSCHEDULED charges is not checked.
+func (cmd CreateChargeCommand) Validate() error {
+	var e vipps.ValidationError
+	e.Check(cmd.AgreementID != "", "agreementId", "is required")
+	e.Check(cmd.Amount.Minor > 0, "amount", "must be positive")
+	internal.CheckChargeDescription(&e, "description", cmd.Description)
+	if cmd.Type != ChargeTypeUnscheduled {
+		internal.CheckDue(&e, "due", cmd.Due.Time, time.Now())
+	}
+	internal.CheckRetryDays(&e, "retryDays", cmd.RetryDays)
+	checkTransactionType(&e, "transactionType", cmd.TransactionType)
+	switch cmd.Type {
+	case "", ChargeTypeRecurring, ChargeTypeUnscheduled:
+	default:
+		e.Add("type", "must be one of RECURRING or UNSCHEDULED")
+	}
+	internal.CheckOrderID(&e, "orderId", cmd.OrderID)
+	return e.Err()
+}
+
+// Validate checks cmd against the rules documented for the Recurring API. It
+// returns a *vipps.ValidationError listing every invalid field.
+func (cmd CaptureChargeCommand) Validate() error {
+	var e vipps.ValidationError
+	checkCharge(&e, cmd.ChargeIdentifier)
+	e.Check(cmd.Amount.Minor > 0, "amount", "must be positive")
+	e.Check(cmd.Description != "", "description", "is required")
+	return e.Err()
+}
+
+// Validate checks cmd against the rules documented for the Recurring API. It
+// returns a *vipps.ValidationError listing every invalid field.
+func (cmd RefundChargeCommand) Validate() error {
+	var e vipps.ValidationError
+	checkCharge(&e, cmd.ChargeIdentifier)
+	e.Check(cmd.Amount.Minor > 0, "amount", "must be positive")
+	e.Check(cmd.Description != "", "description", "is required")
+	return e.Err()
+}
+
+func checkPricing(e *vipps.ValidationError, p Pricing) {
+	e.Check(p.Currency == CurrencyNOK, "pricing.currency", "must be NOK")
+	switch p.Type {
+	case PricingTypeLegacy:
+		e.Check(p.Amount.Minor > 0, "pricing.amount", "must be positive")
+	case PricingTypeVariable:
+		e.Check(p.SuggestedMaxAmount.Minor > 0, "pricing.suggestedMaxAmount", "must be positive")
+	default:
+		e.Add("pricing.type", "must be one of LEGACY or VARIABLE")
+	}
+}
+
+func checkCharge(e *vipps.ValidationError, id ChargeIdentifier) {
+	e.Check(id.AgreementID != "", "agreementId", "is required")
+	e.Check(id.ChargeID != "", "chargeId", "is required")
+}
+
+func checkTransactionType(e *vipps.ValidationError, field string, t TransactionType) {
+	internal.CheckOneOf(e, field, string(t), string(TransactionTypeDirectCapture), string(TransactionTypeReserveCapture))
+}
@@ -0,0 +1,91 @@
+package recurring
+
+import (
+	"github.com/torfjor/go-vipps"
+	"github.com/torfjor/go-vipps/internal"
+	"time"
+)
+
+// Validate checks cmd against the rules documented for the Recurring API. It
+// returns a *vipps.ValidationError listing every invalid field.
+func (cmd CreateAgreementCommand) Validate() error {
+	var e vipps.ValidationError
+	e.Check(cmd.Currency == CurrencyNOK, "currency", "must be NOK")
+	if n := cmd.CustomerPhoneNumber; n != "" {
+		e.Check(internal.ValidMobileNumber(n), "customerPhoneNumber", "must be an 8 digit Norwegian mobile number")
+	}
+	internal.CheckOneOf(&e, "interval", string(cmd.Interval),
+		string(ChargeIntervalDay), string(ChargeIntervalWeek), string(ChargeIntervalMonth))
+	internal.CheckIntervalCount(&e, "intervalCount", cmd.IntervalCount)
+	e.Check(internal.IsHTTPS(cmd.AgreementURL), "merchantAgreementUrl", "must be an https URL")
+	e.Check(cmd.RedirectURL != "", "merchantRedirectUrl", "is required")
+	e.Check(cmd.IsApp || cmd.RedirectURL == "" || internal.IsHTTPS(cmd.RedirectURL), "merchantRedirectUrl", "must be an https URL")
+	e.Check(cmd.Price.Minor > 0, "price", "must be positive")
+	internal.CheckProduct(&e, cmd.ProductName, cmd.ProductDescription, true)
+	checkCampaign(&e, cmd.Campaign, cmd.Price)
+	if ic := cmd.InitialCharge; !ic.Amount.IsZero() || ic.Description != "" {
+		e.Check(ic.Amount.Minor > 0, "initialCharge.amount", "must be positive")
+		e.Check(ic.Currency == CurrencyNOK, "initialCharge.currency", "must be NOK")
+		internal.CheckChargeDescription(&e, "initialCharge.description", ic.Description)
+		checkTransactionType(&e, "initialCharge.transactionType", ic.TransactionType)
+		internal.CheckOrderID(&e, "initialCharge.orderId", ic.OrderID)
+	}
+	return e.Err()
+}
+
+// Validate checks cmd against the rules documented for the Recurring API. It
+// returns a *vipps.ValidationError listing every invalid field. The campaign
+// price is only checked against a price in the same command.
+func (cmd UpdateAgreementCommand) Validate() error {
+	var e vipps.ValidationError
+	e.Check(cmd.AgreementID != "", "agreementId", "is required")
+	if cmd.Price != nil {
+		e.Check(cmd.Price.Minor > 0, "price", "must be positive")
+		checkCampaign(&e, cmd.Campaign, *cmd.Price)
+	}
+	internal.CheckProduct(&e, cmd.ProductName, cmd.ProductDescription, false)
+	e.Check(cmd.Status == "" || cmd.Status == AgreementStatusStopped, "status", "can only be changed to STOPPED")
+	return e.Err()
+}
+
+// Validate checks cmd against the rules documented for the Recurring API, as
+// of the current time. It returns a *vipps.ValidationError listing every
+// invalid field.
+func (cmd CreateChargeCommand) Validate() error {
+	var e vipps.ValidationError
+	e.Check(cmd.AgreementID != "", "agreementId", "is required")
+	e.Check(cmd.Amount.Minor > 0, "amount", "must be positive")
+	e.Check(cmd.Currency == "" || cmd.Currency == CurrencyNOK, "currency", "must be NOK")
+	internal.CheckChargeDescription(&e, "description", cmd.Description)
+	internal.CheckDue(&e, "due", cmd.Due.Time, time.Now())
+	internal.CheckRetryDays(&e, "retryDays", cmd.RetryDays)
+	internal.CheckOrderID(&e, "orderId", cmd.OrderID)
+	return e.Err()
+}
+
+// Validate checks cmd against the rules documented for the Recurring API. It
+// returns a *vipps.ValidationError listing every invalid field.
+func (cmd RefundChargeCommand) Validate() error {
+	var e vipps.ValidationError
+	checkCharge(&e, cmd.ChargeIdentifier)
+	e.Check(cmd.Amount.Minor > 0, "amount", "must be positive")
+	e.Check(cmd.Description != "", "description", "is required")
+	return e.Err()
+}
+
+func checkCharge(e *vipps.ValidationError, id ChargeIdentifier) {
+	e.Check(id.AgreementID != "", "agreementId", "is required")
+	e.Check(id.ChargeID != "", "chargeId", "is required")
+}
+
+func checkCampaign(e *vipps.ValidationError, c *Campaign, price vipps.Money) {
+	if c == nil {
+		return
+	}
+	e.Check(c.Price.Minor >= 0, "campaign.campaignPrice", "cannot be negative")
+	e.Check(c.Price.Minor < price.Minor, "campaign.campaignPrice", "must be lower than price")
+}
+
+func checkTransactionType(e *vipps.ValidationError, field string, t TransactionType) {
+	internal.CheckOneOf(e, field, string(t), string(TransactionTypeDirectCapture), string(TransactionTypeReserveCapture))
+}
@@ -0,0 +1,136 @@
+package vipps
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// Tracer starts spans for calls to and from the Vipps APIs. It is deliberately
+// small, so that it can be implemented on top of any tracing library. Package
+// otel implements it on top of an OpenTelemetry trace.Tracer:
+//
+//	config.Tracer = otel.NewTracer(otelglobal.Tracer("github.com/torfjor/go-vipps"))
+//
+// Spans are started as children of the span in the given context, if any.
+type Tracer interface {
+	Start(ctx context.Context, name string, kind SpanKind, attrs ...Attribute) (context.Context, Span)
+}
+
+// Span is a single operation within a trace.
+type Span interface {
+	SetAttributes(attrs ...Attribute)
+	// RecordError records err and marks the span as failed.
+	RecordError(err error)
+	End()
+}
+
+// SpanKind is the role of a span in a trace.
+type SpanKind int
+
+// List of values that SpanKind can take.
+const (
+	SpanKindInternal SpanKind = iota
+	SpanKindClient
+	SpanKindServer
+)
+
+// Attribute is a key-value pair describing a span. Value is a string, an int
+// or a bool.
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// Attribute keys set on spans.
+const (
+	AttributeOperation         = "vipps.operation"
+	AttributeOrderID           = "vipps.order_id"
+	AttributeAgreementID       = "vipps.agreement_id"
+	AttributeChargeID          = "vipps.charge_id"
+	AttributeReference         = "vipps.reference"
+	AttributeTransactionStatus = "vipps.transaction_status"
+	AttributeErrorCodes        = "vipps.error_codes"
+	AttributeHTTPMethod        = "http.method"
+	AttributeHTTPURL           = "http.url"
+	AttributeHTTPStatus        = "http.status_code"
+)
+
+// OrderIDAttr returns an Attribute for an Ecom order ID.
+func OrderIDAttr(id string) Attribute {
+	return Attribute{Key: AttributeOrderID, Value: id}
+}
+
+// AgreementIDAttr returns an Attribute for a Recurring agreement ID.
+func AgreementIDAttr(id string) Attribute {
+	return Attribute{Key: AttributeAgreementID, Value: id}
+}
+
+// ChargeIDAttr returns an Attribute for a Recurring charge ID.
+func ChargeIDAttr(id string) Attribute {
+	return Attribute{Key: AttributeChargeID, Value: id}
+}
+
+// ReferenceAttr returns an Attribute for an ePayment reference.
+func ReferenceAttr(reference string) Attribute {
+	return Attribute{Key: AttributeReference, Value: reference}
+}
+
+// StartSpan starts a span of the given kind for operation, e.g.
+// `ecom.CapturePayment`, with tracer. If tracer is nil, the returned Span does
+// nothing. End it with EndSpan. The returned context carries operation, see
+// Operation.
+func StartSpan(ctx context.Context, tracer Tracer, kind SpanKind, operation string, attrs ...Attribute) (context.Context, Span) {
+	ctx = context.WithValue(ctx, operationKey{}, operation)
+	if tracer == nil {
+		return ctx, nopSpan{}
+	}
+	attrs = append([]Attribute{{Key: AttributeOperation, Value: operation}}, attrs...)
+	return tracer.Start(ctx, operation, kind, attrs...)
+}
+
+// EndSpan records err, if any, on span and ends it. The HTTP status and the
+// Vipps error codes of an *APIError are recorded as attributes.
+func EndSpan(span Span, err error) {
+	if err != nil {
+		var apiErr *APIError
+		if errors.As(err, &apiErr) {
+			span.SetAttributes(Attribute{Key: AttributeHTTPStatus, Value: apiErr.Status})
+		}
+		var coded interface{ ErrorCodes() []string }
+		if errors.As(err, &coded) {
+			span.SetAttributes(Attribute{Key: AttributeErrorCodes, Value: strings.Join(coded.ErrorCodes(), ",")})
+		}
+		span.RecordError(err)
+	}
+	span.End()
+}
+
+// Trace returns a Middleware that starts a client span with tracer for every
+// request, as a child of the span in the request's context.
+func Trace(tracer Tracer) Middleware {
+	return func(next Doer) Doer {
+		return DoerFunc(func(req *http.Request) (*http.Response, error) {
+			ctx, span := tracer.Start(req.Context(), "HTTP "+req.Method, SpanKindClient,
+				Attribute{Key: AttributeHTTPMethod, Value: req.Method},
+				Attribute{Key: AttributeHTTPURL, Value: req.URL.String()},
+			)
+			defer span.End()
+
+			resp, err := next.Do(req.WithContext(ctx))
+			if err != nil {
+				span.RecordError(err)
+				return nil, err
+			}
+			span.SetAttributes(Attribute{Key: AttributeHTTPStatus, Value: resp.StatusCode})
+			return resp, nil
+		})
+	}
+}
+
+type nopSpan struct{}
+
+func (nopSpan) SetAttributes(...Attribute) {}
+func (nopSpan) RecordError(error)          {}
+func (nopSpan) End()                       {}
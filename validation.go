@@ -0,0 +1,46 @@
+package vipps
+
+import (
+	"strings"
+)
+
+// InvalidField describes why the value of a field in a command is invalid.
+// Field is the JSON path of the field, e.g. `transaction.orderId`.
+type InvalidField struct {
+	Field  string
+	Reason string
+}
+
+// ValidationError is returned by clients when a command fails validation
+// before it is sent to Vipps. It lists every invalid field.
+type ValidationError struct {
+	Fields []InvalidField
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		msgs[i] = f.Field + " " + f.Reason
+	}
+	return "vipps: invalid command: " + strings.Join(msgs, "; ")
+}
+
+// Add records that field is invalid for reason.
+func (e *ValidationError) Add(field, reason string) {
+	e.Fields = append(e.Fields, InvalidField{Field: field, Reason: reason})
+}
+
+// Check records that field is invalid for reason, unless ok is true.
+func (e *ValidationError) Check(ok bool, field, reason string) {
+	if !ok {
+		e.Add(field, reason)
+	}
+}
+
+// Err returns e if any field is invalid, and nil otherwise.
+func (e *ValidationError) Err() error {
+	if len(e.Fields) == 0 {
+		return nil
+	}
+	return e
+}
@@ -1,9 +1,13 @@
 package vipps
 
 import (
+	"errors"
 	"fmt"
 	"github.com/go-kit/kit/log"
+	"github.com/torfjor/go-vipps/internal"
 	"net/http"
+	"strings"
+	"time"
 )
 
 const (
@@ -11,25 +15,66 @@ const (
 	BaseURLTesting = "https://apitest.vipps.no"
 )
 
+// Version is the version of this library, sent in the Vipps system headers.
+const Version = "0.1.0"
+
+// libraryName identifies this library in the Vipps system headers.
+const libraryName = "go-vipps"
+
+// Headers that identify the merchant and the system integrating with the Vipps
+// APIs. Vipps asks integrators to send them on every request.
+const (
+	HeaderMerchantSerialNumber = internal.HeaderMerchantSerialNumber
+	HeaderSystemName           = "Vipps-System-Name"
+	HeaderSystemVersion        = "Vipps-System-Version"
+	HeaderPluginName           = "Vipps-System-Plugin-Name"
+	HeaderPluginVersion        = "Vipps-System-Plugin-Version"
+)
+
 // ErrUnexpectedResponse represents an unexpected erroneous response from the
 // Vipps APIs.
 type ErrUnexpectedResponse struct {
 	Body   []byte
 	Status int
+	// HTTPError is the original error for the response, with its headers.
+	HTTPError internal.HTTPError
 }
 
 func (e ErrUnexpectedResponse) Error() string {
 	return fmt.Sprintf("unexpected response from Vipps, body: %s, status: %d", e.Body, e.Status)
 }
 
+// Unwrap returns the original error for the response.
+func (e ErrUnexpectedResponse) Unwrap() error {
+	return e.HTTPError
+}
+
 // Environment is the Vipps environment that a Client should use.
 type Environment string
 
 // List of values that Environment can take.
 const (
-	EnvironmentTesting Environment = "testing"
+	EnvironmentTesting    Environment = "testing"
+	EnvironmentProduction Environment = "production"
 )
 
+// ErrUnknownEnvironment is returned for an Environment that is not one of
+// EnvironmentTesting or EnvironmentProduction.
+var ErrUnknownEnvironment = errors.New("vipps: unknown environment")
+
+// BaseURL returns the base URL of the Vipps APIs in e. The empty Environment is
+// production, as it was before EnvironmentProduction was added. This is
+// deprecated: set EnvironmentProduction explicitly.
+func (e Environment) BaseURL() (string, error) {
+	switch e {
+	case EnvironmentTesting:
+		return BaseURLTesting, nil
+	case EnvironmentProduction, "":
+		return BaseURL, nil
+	}
+	return "", fmt.Errorf("%w: %q", ErrUnknownEnvironment, string(e))
+}
+
 // Credentials represents secrets used to authenticate and authorize a client
 // to the Vipps APIs.
 type Credentials struct {
@@ -40,7 +85,109 @@ type Credentials struct {
 
 // ClientConfig represents the configuration to use for a Client
 type ClientConfig struct {
+	// Environment is the Vipps environment to use. If neither it nor BaseURL
+	// is set, production is used, but this is deprecated and rejected by
+	// Validate.
 	Environment Environment
-	Logger      log.Logger
-	HTTPClient  *http.Client
+	// BaseURL, if set, overrides the base URL of the Environment, e.g. to use
+	// a proxy or a fake like vippstest.Server. Give the same URL to the auth
+	// client with auth.WithBaseURL.
+	BaseURL string
+	Logger  log.Logger
+	// HTTPClient sends requests to the Vipps APIs. It must add the headers
+	// required by them, like the client returned by auth.NewClient.
+	HTTPClient *http.Client
+	// Credentials, if HTTPClient is not set, are used by the New functions of
+	// the API packages to build an authenticated HTTPClient.
+	Credentials Credentials
+	// Transport, if set, is the http.RoundTripper that such a HTTPClient
+	// sends requests with. It defaults to a clone of http.DefaultTransport.
+	Transport http.RoundTripper
+	// RetryPolicy, if set, makes the Client retry requests that fail with a
+	// transport error, a 5xx or a 429 response. Mutating requests are only
+	// retried when they carry an idempotency key.
+	RetryPolicy *RetryPolicy
+	// Tracer, if set, traces every call on the Client and every request it
+	// sends.
+	Tracer Tracer
+	// Metrics, if set, are updated for every request sent by the Client.
+	Metrics *Metrics
+	// Middleware wraps every request sent by the Client, the first
+	// Middleware outermost.
+	Middleware []Middleware
+	// SkipValidation disables the validation of commands that the Client
+	// otherwise does before sending them.
+	SkipValidation bool
+	// IdempotencyStore, if set, remembers the idempotency keys that the
+	// Client generates for commands that have none, until the operation has
+	// a definitive outcome.
+	IdempotencyStore IdempotencyStore
+
+	// MerchantSerialNumber, if set, is sent with every request. A serial
+	// number given on a command or with ContextWithMerchant takes precedence.
+	MerchantSerialNumber string
+	// SystemName and SystemVersion identify the system integrating with
+	// Vipps, e.g. the web shop. They default to this library.
+	SystemName    string
+	SystemVersion string
+	// PluginName and PluginVersion identify the plugin that the system uses
+	// to integrate with Vipps. They default to this library.
+	PluginName    string
+	PluginVersion string
+}
+
+// APIBaseURL returns the BaseURL, if set, or else the base URL of the
+// Environment.
+func (c ClientConfig) APIBaseURL() (string, error) {
+	if c.BaseURL != "" {
+		return strings.TrimSuffix(c.BaseURL, "/"), nil
+	}
+	return c.Environment.BaseURL()
+}
+
+// Headers returns the Vipps system headers for the config, with defaults that
+// identify this library for the fields that are not set.
+func (c ClientConfig) Headers() http.Header {
+	h := http.Header{}
+	if c.MerchantSerialNumber != "" {
+		h.Set(HeaderMerchantSerialNumber, c.MerchantSerialNumber)
+	}
+	h.Set(HeaderSystemName, orDefault(c.SystemName, libraryName))
+	h.Set(HeaderSystemVersion, orDefault(c.SystemVersion, Version))
+	h.Set(HeaderPluginName, orDefault(c.PluginName, libraryName))
+	h.Set(HeaderPluginVersion, orDefault(c.PluginVersion, Version))
+	return h
+}
+
+func orDefault(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
+
+// RetryPolicy controls how failed requests to the Vipps APIs are retried.
+//
+// Attempts are spaced with exponential backoff and jitter, starting at
+// MinBackoff and doubling up to MaxBackoff. A `Retry-After` header in the
+// response takes precedence over the computed backoff.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts, including the first.
+	// Values below 2 disable retries.
+	MaxAttempts int
+	// MinBackoff is the backoff before the first retry. Defaults to 100ms.
+	MinBackoff time.Duration
+	// MaxBackoff caps the backoff between two attempts.
+	MaxBackoff time.Duration
+	// MaxElapsed, if positive, is the total time budget for all attempts. No
+	// retry is made if waiting for it would exceed the budget.
+	MaxElapsed time.Duration
+}
+
+// DefaultRetryPolicy is a sensible RetryPolicy for most integrations.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 4,
+	MinBackoff:  200 * time.Millisecond,
+	MaxBackoff:  5 * time.Second,
+	MaxElapsed:  30 * time.Second,
 }
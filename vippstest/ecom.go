@@ -0,0 +1,383 @@
+package vippstest
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/torfjor/go-vipps"
+	"github.com/torfjor/go-vipps/ecom"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const ecomEndpoint = "ecomm/v2/payments"
+
+// payment is the state kept for an initiated Vipps Ecom payment.
+type payment struct {
+	merchantSerialNumber string
+	orderID              string
+	amount               int64
+	callbackURL          string
+	authToken            string
+	// state is the operation that last changed the reservation: INITIATE,
+	// RESERVE, CANCEL or VOID.
+	state    ecom.Operation
+	captured int64
+	refunded int64
+	log      []ecom.TransactionLogEntry
+	// replies holds responses to mutating requests by operation and
+	// `X-Request-ID`, to make retries idempotent.
+	replies map[string]reply
+}
+
+type reply struct {
+	status int
+	body   interface{}
+}
+
+func (p *payment) summary() ecom.TransactionSummary {
+	var remaining int64
+	if p.state == ecom.OperationReserve {
+		remaining = p.amount - p.captured
+	}
+	return ecom.TransactionSummary{
+		CapturedAmount:           vipps.Ore(p.captured),
+		RefundedAmount:           vipps.Ore(p.refunded),
+		RemainingAmountToCapture: vipps.Ore(remaining),
+		RemainingAmountToRefund:  vipps.Ore(p.captured - p.refunded),
+	}
+}
+
+func (p *payment) record(op ecom.Operation, txID, text string, amount int64, requestID string, at time.Time) {
+	entry := ecom.TransactionLogEntry{
+		Amount:           vipps.Ore(amount),
+		Operation:        op,
+		OperationSuccess: true,
+		RequestID:        requestID,
+		Timestamp:        &at,
+		TransactionID:    txID,
+		TransactionText:  text,
+	}
+	// Vipps lists the most recent operation first.
+	p.log = append([]ecom.TransactionLogEntry{entry}, p.log...)
+}
+
+func (p *payment) details() *ecom.Payment {
+	log := make([]ecom.TransactionLogEntry, len(p.log))
+	copy(log, p.log)
+	return &ecom.Payment{
+		OrderID:            p.orderID,
+		TransactionLog:     log,
+		TransactionSummary: p.summary(),
+	}
+}
+
+// ecomError writes an error response shaped like ecom.ErrEcom.
+func ecomError(status int, group, code, message string) reply {
+	return reply{status, ecom.ErrEcom{{Group: group, Code: code, Message: message}}}
+}
+
+var (
+	errOrderNotFound      = ecomError(http.StatusNotFound, "InvalidRequest", "35", "Requested Order not found")
+	errDuplicateOrderID   = ecomError(http.StatusBadRequest, "Merchant", "34", "Unique constraint violation of the orderId")
+	errCancelCaptured     = ecomError(http.StatusBadRequest, "Payment", "51", "Cannot cancel an already captured order")
+	errCaptureExceeds     = ecomError(http.StatusBadRequest, "Payment", "61", "Captured amount exceeds the reserved amount")
+	errCaptureNotReserved = ecomError(http.StatusBadRequest, "Payment", "62", "The amount you tried to capture is not reserved")
+	errAlreadyCaptured    = ecomError(http.StatusBadRequest, "Payment", "63", "Captured amount is already captured")
+	errRefundExceeds      = ecomError(http.StatusBadRequest, "Payment", "71", "Cannot refund more than captured amount")
+	errRefundReserved     = ecomError(http.StatusBadRequest, "Payment", "72", "Cannot refund a reserved order (only cancel)")
+	errRefundCancelled    = ecomError(http.StatusBadRequest, "Payment", "73", "Cannot refund on cancelled order")
+	errNotAllowed         = ecomError(http.StatusBadRequest, "Vipps", "91", "Transaction is not allowed")
+)
+
+func invalidRequest(message string) reply {
+	return ecomError(http.StatusBadRequest, "InvalidRequest", "", message)
+}
+
+// handleEcom routes requests for the Ecom v2 payments endpoints.
+func (s *Server) handleEcom(w http.ResponseWriter, r *http.Request) {
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/"+ecomEndpoint), "/")
+	segments := strings.Split(rest, "/")
+
+	var res reply
+	switch {
+	case rest == "" && r.Method == http.MethodPost:
+		res = s.initiatePayment(r)
+	case len(segments) == 2 && segments[1] == "details" && r.Method == http.MethodGet:
+		res = s.paymentDetails(segments[0])
+	case len(segments) == 2 && segments[1] == "capture" && r.Method == http.MethodPost:
+		res = s.capturePayment(segments[0], r)
+	case len(segments) == 2 && segments[1] == "refund" && r.Method == http.MethodPost:
+		res = s.refundPayment(segments[0], r)
+	case len(segments) == 2 && segments[1] == "cancel" && r.Method == http.MethodPut:
+		res = s.cancelPayment(segments[0], r)
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	writeJSON(w, res.status, res.body)
+}
+
+func (s *Server) initiatePayment(r *http.Request) reply {
+	var cmd ecom.InitiatePaymentCommand
+	if err := json.NewDecoder(r.Body).Decode(&cmd); err != nil {
+		return invalidRequest(err.Error())
+	}
+	switch {
+	case cmd.MerchantInfo.MerchantSerialNumber == "":
+		return invalidRequest("merchantInfo.merchantSerialNumber is required")
+	case cmd.Transaction.OrderID == "":
+		return invalidRequest("transaction.orderId is required")
+	case cmd.Transaction.Amount.Minor <= 0:
+		return invalidRequest("transaction.amount must be positive")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.payments[cmd.Transaction.OrderID]; ok {
+		return errDuplicateOrderID
+	}
+	p := &payment{
+		merchantSerialNumber: cmd.MerchantInfo.MerchantSerialNumber,
+		orderID:              cmd.Transaction.OrderID,
+		amount:               cmd.Transaction.Amount.Minor,
+		callbackURL:          cmd.MerchantInfo.CallbackURL,
+		authToken:            cmd.MerchantInfo.AuthToken,
+		state:                ecom.OperationInitiate,
+		replies:              make(map[string]reply),
+	}
+	p.record(ecom.OperationInitiate, s.transactionID(), cmd.Transaction.TransactionText, p.amount, "", s.now())
+	s.payments[p.orderID] = p
+
+	return reply{http.StatusOK, ecom.PaymentReference{
+		OrderID: p.orderID,
+		URL:     fmt.Sprintf("%s/landing?orderId=%s", s.URL, p.orderID),
+	}}
+}
+
+func (s *Server) paymentDetails(orderID string) reply {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.payments[orderID]
+	if !ok {
+		return errOrderNotFound
+	}
+	return reply{http.StatusOK, p.details()}
+}
+
+// transactionCommand is the body of capture, refund and cancel requests.
+type transactionCommand struct {
+	MerchantInfo struct {
+		MerchantSerialNumber string `json:"merchantSerialNumber"`
+	} `json:"merchantInfo"`
+	Transaction struct {
+		Amount          int64  `json:"amount"`
+		TransactionText string `json:"transactionText"`
+	} `json:"transaction"`
+}
+
+// mutate decodes a transactionCommand and applies fn to the payment under
+// lock. Replies are remembered by `X-Request-ID`, so a retried request gets
+// the original reply instead of being applied twice.
+func (s *Server) mutate(orderID string, op ecom.Operation, r *http.Request, fn func(p *payment, cmd transactionCommand, requestID string) reply) reply {
+	var cmd transactionCommand
+	if err := json.NewDecoder(r.Body).Decode(&cmd); err != nil {
+		return invalidRequest(err.Error())
+	}
+	requestID := r.Header.Get("X-Request-ID")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.payments[orderID]
+	if !ok {
+		return errOrderNotFound
+	}
+	if cmd.MerchantInfo.MerchantSerialNumber != p.merchantSerialNumber {
+		return invalidRequest("merchantInfo.merchantSerialNumber does not match the order")
+	}
+	key := string(op) + "/" + requestID
+	if res, ok := p.replies[key]; ok && requestID != "" {
+		return res
+	}
+	res := fn(p, cmd, requestID)
+	if requestID != "" {
+		p.replies[key] = res
+	}
+	return res
+}
+
+func (s *Server) capturePayment(orderID string, r *http.Request) reply {
+	return s.mutate(orderID, ecom.OperationCapture, r, func(p *payment, cmd transactionCommand, requestID string) reply {
+		if p.state != ecom.OperationReserve {
+			if p.state == ecom.OperationInitiate {
+				return errCaptureNotReserved
+			}
+			return errNotAllowed
+		}
+		remaining := p.amount - p.captured
+		amount := cmd.Transaction.Amount
+		if amount == 0 {
+			amount = remaining
+		}
+		switch {
+		case amount < 0:
+			return invalidRequest("transaction.amount cannot be negative")
+		case remaining == 0:
+			return errAlreadyCaptured
+		case amount > remaining:
+			return errCaptureExceeds
+		}
+
+		now := s.now()
+		txID := s.transactionID()
+		p.captured += amount
+		p.record(ecom.OperationCapture, txID, cmd.Transaction.TransactionText, amount, requestID, now)
+
+		return reply{http.StatusOK, ecom.CapturedPayment{
+			OrderID:            p.orderID,
+			TransactionInfo:    transactionInfo(amount, ecom.TransactionStatusCaptured, txID, cmd.Transaction.TransactionText, now),
+			TransactionSummary: p.summary(),
+		}}
+	})
+}
+
+func (s *Server) refundPayment(orderID string, r *http.Request) reply {
+	return s.mutate(orderID, ecom.OperationRefund, r, func(p *payment, cmd transactionCommand, requestID string) reply {
+		if p.captured == 0 {
+			switch p.state {
+			case ecom.OperationReserve:
+				return errRefundReserved
+			case ecom.OperationCancel, ecom.OperationVoid:
+				return errRefundCancelled
+			default:
+				return errNotAllowed
+			}
+		}
+		remaining := p.captured - p.refunded
+		amount := cmd.Transaction.Amount
+		if amount == 0 {
+			amount = remaining
+		}
+		switch {
+		case amount < 0:
+			return invalidRequest("transaction.amount cannot be negative")
+		case amount == 0 || amount > remaining:
+			return errRefundExceeds
+		}
+
+		now := s.now()
+		txID := s.transactionID()
+		p.refunded += amount
+		p.record(ecom.OperationRefund, txID, cmd.Transaction.TransactionText, amount, requestID, now)
+
+		return reply{http.StatusOK, ecom.RefundedPayment{
+			OrderID:            p.orderID,
+			TransactionInfo:    transactionInfo(amount, ecom.TransactionStatusRefunded, txID, cmd.Transaction.TransactionText, now),
+			TransactionSummary: p.summary(),
+		}}
+	})
+}
+
+func (s *Server) cancelPayment(orderID string, r *http.Request) reply {
+	return s.mutate(orderID, ecom.OperationCancel, r, func(p *payment, cmd transactionCommand, requestID string) reply {
+		if p.captured > 0 {
+			return errCancelCaptured
+		}
+		var op ecom.Operation
+		switch p.state {
+		case ecom.OperationInitiate:
+			op = ecom.OperationCancel
+		case ecom.OperationReserve:
+			op = ecom.OperationVoid
+		default:
+			return errNotAllowed
+		}
+
+		now := s.now()
+		txID := s.transactionID()
+		p.state = op
+		p.record(op, txID, cmd.Transaction.TransactionText, p.amount, requestID, now)
+
+		return reply{http.StatusOK, ecom.CancelledPayment{
+			OrderID:            p.orderID,
+			TransactionInfo:    transactionInfo(p.amount, ecom.TransactionStatusMerchantCancelled, txID, cmd.Transaction.TransactionText, now),
+			TransactionSummary: p.summary(),
+		}}
+	})
+}
+
+func transactionInfo(amount int64, status ecom.TransactionStatus, txID, text string, at time.Time) ecom.TransactionInfo {
+	return ecom.TransactionInfo{
+		Amount:          vipps.Ore(amount),
+		Status:          status,
+		Timestamp:       &at,
+		TransactionID:   txID,
+		TransactionText: text,
+	}
+}
+
+// Payment returns the current details of the payment for orderID, as returned
+// by the `/details` endpoint.
+func (s *Server) Payment(orderID string) (*ecom.Payment, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.payments[orderID]
+	if !ok {
+		return nil, false
+	}
+	return p.details(), true
+}
+
+// Approve simulates the user approving the payment for orderID in the Vipps
+// app. The amount is reserved and a transaction update with status `RESERVED`
+// is sent to the callback URL of the payment, if any.
+func (s *Server) Approve(orderID string) error {
+	return s.complete(orderID, ecom.OperationReserve, ecom.TransactionStatusReserved)
+}
+
+// Reject simulates the user rejecting the payment for orderID in the Vipps
+// app. The payment is cancelled and a transaction update with status
+// `CANCELLED` is sent to the callback URL of the payment, if any.
+func (s *Server) Reject(orderID string) error {
+	return s.complete(orderID, ecom.OperationCancel, ecom.TransactionStatusCancelled)
+}
+
+func (s *Server) complete(orderID string, op ecom.Operation, status ecom.TransactionStatus) error {
+	s.mu.Lock()
+	p, ok := s.payments[orderID]
+	if !ok {
+		s.mu.Unlock()
+		return fmt.Errorf("vippstest: order %q not found", orderID)
+	}
+	if p.state != ecom.OperationInitiate {
+		s.mu.Unlock()
+		return fmt.Errorf("vippstest: order %q is not awaiting the user (last operation %s)", orderID, p.state)
+	}
+	now := s.now()
+	txID := s.transactionID()
+	p.state = op
+	p.record(op, txID, "", p.amount, "", now)
+
+	update := ecom.TransactionUpdate{
+		MerchantSerialNumber: p.merchantSerialNumber,
+		OrderID:              p.orderID,
+		TransactionInfo: &ecom.TransactionInfo{
+			Amount:        vipps.Ore(p.amount),
+			Status:        status,
+			Timestamp:     &now,
+			TransactionID: txID,
+		},
+	}
+	callbackURL, authToken := p.callbackURL, p.authToken
+	s.mu.Unlock()
+
+	if callbackURL == "" {
+		return nil
+	}
+	return s.postCallback(strings.TrimSuffix(callbackURL, "/")+"/v2/payments/"+orderID, authToken, update)
+}
@@ -0,0 +1,269 @@
+package vippstest_test
+
+import (
+	"context"
+	"errors"
+	"github.com/torfjor/go-vipps"
+	"github.com/torfjor/go-vipps/auth"
+	"github.com/torfjor/go-vipps/ecom"
+	"github.com/torfjor/go-vipps/vippstest"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+const (
+	merchantSerialNumber = "123456"
+	callbackToken        = "callback-token"
+)
+
+var credentials = vipps.Credentials{
+	APISubscriptionKey: "subscription-key",
+	ClientID:           "client-id",
+	ClientSecret:       "client-secret",
+}
+
+// newEcomClient returns a Server requiring credentials, and an ecom.Client
+// authenticating to it with them.
+func newEcomClient(t *testing.T) (*vippstest.Server, *ecom.Client) {
+	t.Helper()
+	srv := vippstest.NewServer(credentials)
+	t.Cleanup(srv.Close)
+
+	client, err := ecom.New(
+		vipps.WithBaseURL(srv.URL),
+		vipps.WithCredentials(credentials),
+		// The callback server is plain http.
+		vipps.WithoutValidation(),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return srv, client
+}
+
+// transactionUpdates returns the URL of a callback server, and a function
+// returning the transaction updates it has received.
+func transactionUpdates(t *testing.T) (string, func() []ecom.TransactionUpdate) {
+	t.Helper()
+	var (
+		mu      sync.Mutex
+		updates []ecom.TransactionUpdate
+	)
+	srv := httptest.NewServer(ecom.HandleTransactionUpdate(callbackToken, func(u ecom.TransactionUpdate) {
+		mu.Lock()
+		defer mu.Unlock()
+		updates = append(updates, u)
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv.URL, func() []ecom.TransactionUpdate {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]ecom.TransactionUpdate(nil), updates...)
+	}
+}
+
+func initiate(t *testing.T, client *ecom.Client, orderID, callbackURL string) {
+	t.Helper()
+	_, err := client.InitiatePayment(context.Background(), ecom.InitiatePaymentCommand{
+		MerchantInfo: ecom.MerchantInfo{
+			MerchantSerialNumber: merchantSerialNumber,
+			AuthToken:            callbackToken,
+			CallbackURL:          callbackURL,
+			RedirectURL:          "https://example.com/fallback",
+		},
+		Transaction: ecom.Transaction{
+			OrderID:         orderID,
+			Amount:          vipps.Ore(1000),
+			TransactionText: "Order",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// errorCode returns the first Ecom error code of err, or "" if it has none.
+func errorCode(err error) string {
+	var ecomErr ecom.ErrEcom
+	if !errors.As(err, &ecomErr) || len(ecomErr) == 0 {
+		return ""
+	}
+	return ecomErr[0].Code
+}
+
+func TestEcomPaymentLifecycle(t *testing.T) {
+	srv, client := newEcomClient(t)
+	callbackURL, updates := transactionUpdates(t)
+	ctx := context.Background()
+
+	initiate(t, client, "order-1", callbackURL)
+	if err := srv.Approve("order-1"); err != nil {
+		t.Fatal(err)
+	}
+	if u := updates(); len(u) != 1 || u[0].OrderID != "order-1" || u[0].TransactionInfo.Status != ecom.TransactionStatusReserved {
+		t.Fatalf("transaction updates = %+v, want one RESERVED", u)
+	}
+
+	captured, err := client.CapturePayment(ctx, ecom.CapturePaymentCommand{
+		OrderID:              "order-1",
+		MerchantSerialNumber: merchantSerialNumber,
+		Amount:               vipps.Ore(400),
+		TransactionText:      "Partial capture",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := captured.TransactionSummary; got.CapturedAmount != vipps.Ore(400) || got.RemainingAmountToCapture != vipps.Ore(600) {
+		t.Errorf("summary after capture = %+v", got)
+	}
+
+	_, err = client.CapturePayment(ctx, ecom.CapturePaymentCommand{
+		OrderID:              "order-1",
+		MerchantSerialNumber: merchantSerialNumber,
+		Amount:               vipps.Ore(700),
+		TransactionText:      "Over-capture",
+	})
+	if code := errorCode(err); code != "61" || !errors.Is(err, vipps.ErrInsufficientReservedAmount) {
+		t.Errorf("over-capture = %v (code %q), want code 61", err, code)
+	}
+
+	refunded, err := client.RefundPayment(ctx, ecom.RefundPaymentCommand{
+		OrderID:              "order-1",
+		MerchantSerialNumber: merchantSerialNumber,
+		Amount:               vipps.Ore(100),
+		TransactionText:      "Refund",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := refunded.TransactionSummary; got.RefundedAmount != vipps.Ore(100) || got.RemainingAmountToRefund != vipps.Ore(300) {
+		t.Errorf("summary after refund = %+v", got)
+	}
+
+	_, err = client.CancelPayment(ctx, ecom.CancelPaymentCommand{
+		OrderID:              "order-1",
+		MerchantSerialNumber: merchantSerialNumber,
+		TransactionText:      "Cancel",
+	})
+	if code := errorCode(err); code != "51" {
+		t.Errorf("cancel after capture = %v (code %q), want code 51", err, code)
+	}
+
+	p, err := client.GetPayment(ctx, "order-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := p.Status()
+	if s.State != ecom.PaymentStatePartiallyRefunded || s.CapturedAmount != vipps.Ore(400) || s.RefundedAmount != vipps.Ore(100) {
+		t.Errorf("status = %+v", s)
+	}
+}
+
+func TestEcomRequestIDReplay(t *testing.T) {
+	srv, client := newEcomClient(t)
+	ctx := context.Background()
+
+	initiate(t, client, "order-1", "")
+	if err := srv.Approve("order-1"); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := ecom.CapturePaymentCommand{
+		IdempotencyKey:       "capture-1",
+		OrderID:              "order-1",
+		MerchantSerialNumber: merchantSerialNumber,
+		Amount:               vipps.Ore(400),
+		TransactionText:      "Capture",
+	}
+	first, err := client.CapturePayment(ctx, cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	retried, err := client.CapturePayment(ctx, cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if retried.TransactionInfo.TransactionID != first.TransactionInfo.TransactionID || retried.IdempotencyKey != "capture-1" {
+		t.Errorf("retried capture = %+v, want the reply to %+v", retried, first)
+	}
+
+	p, ok := srv.Payment("order-1")
+	if !ok {
+		t.Fatal("payment not found")
+	}
+	var captures int
+	for _, e := range p.TransactionLog {
+		if e.Operation == ecom.OperationCapture {
+			captures++
+		}
+	}
+	if captures != 1 || p.TransactionSummary.CapturedAmount != vipps.Ore(400) {
+		t.Errorf("captures = %d, captured %v, want one of %v", captures, p.TransactionSummary.CapturedAmount, vipps.Ore(400))
+	}
+
+	// A new request ID is a new capture.
+	cmd.IdempotencyKey = "capture-2"
+	if _, err := client.CapturePayment(ctx, cmd); err != nil {
+		t.Fatal(err)
+	}
+	if p, _ := srv.Payment("order-1"); p.TransactionSummary.CapturedAmount != vipps.Ore(800) {
+		t.Errorf("captured = %v, want %v", p.TransactionSummary.CapturedAmount, vipps.Ore(800))
+	}
+}
+
+func TestEcomReject(t *testing.T) {
+	srv, client := newEcomClient(t)
+	callbackURL, updates := transactionUpdates(t)
+
+	initiate(t, client, "order-1", callbackURL)
+	if err := srv.Reject("order-1"); err != nil {
+		t.Fatal(err)
+	}
+	if u := updates(); len(u) != 1 || u[0].TransactionInfo.Status != ecom.TransactionStatusCancelled {
+		t.Errorf("transaction updates = %+v, want one CANCELLED", u)
+	}
+	if err := srv.Approve("order-1"); err == nil {
+		t.Error("Approve after Reject succeeded, want error")
+	}
+	if p, _ := srv.Payment("order-1"); p.State() != ecom.PaymentStateCancelled {
+		t.Errorf("state = %s, want %s", p.State(), ecom.PaymentStateCancelled)
+	}
+}
+
+func TestEcomAuthorization(t *testing.T) {
+	srv := vippstest.NewServer(credentials)
+	defer srv.Close()
+	ctx := context.Background()
+
+	tests := []struct {
+		name       string
+		httpClient *http.Client
+		wantErr    error
+	}{
+		{"valid credentials", auth.NewClient(vipps.EnvironmentTesting, credentials, auth.WithBaseURL(srv.URL)), vipps.ErrNotFound},
+		{"no token", srv.Client(), vipps.ErrUnauthorized},
+		{"wrong secret", auth.NewClient(vipps.EnvironmentTesting, vipps.Credentials{
+			APISubscriptionKey: credentials.APISubscriptionKey,
+			ClientID:           credentials.ClientID,
+			ClientSecret:       "wrong",
+		}, auth.WithBaseURL(srv.URL)), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := ecom.NewClient(vipps.ClientConfig{HTTPClient: tt.httpClient, BaseURL: srv.URL})
+			_, err := client.GetPayment(ctx, "unknown")
+			if tt.wantErr == nil {
+				if err == nil {
+					t.Error("GetPayment succeeded, want error")
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("GetPayment = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,313 @@
+package vippstest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/torfjor/go-vipps/login"
+	"gopkg.in/square/go-jose.v2"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	issuerPath     = "/access-management-1.0/access/"
+	codeLifetime   = time.Minute
+	idTokenKeyID   = "vippstest"
+	idTokenSignAlg = jose.RS256
+)
+
+// Issuer is a local stand-in for the Vipps Login OpenID Connect issuer. It
+// serves discovery, JWKS, authorize, token and userinfo endpoints, and signs ID
+// tokens with a key generated when it is started.
+//
+// Every authorization request is approved at once, on behalf of a user with
+// the Claims set with SetClaims. The user is redirected back to the
+// `redirect_uri` with an authorization code, which can be exchanged with
+// login.Provider.HandleRedirect. The nonce is returned in the ID token, and a
+// PKCE code challenge must be matched by the code verifier:
+//
+//	issuer := vippstest.NewIssuer("client-id", "client-secret")
+//	defer issuer.Close()
+//
+//	provider, err := login.NewProvider(ctx, &login.ProviderConfig{
+//		ClientID:     "client-id",
+//		ClientSecret: "client-secret",
+//		IssuerURL:    issuer.IssuerURL(),
+//		RedirectURL:  "http://localhost/redirect",
+//	})
+type Issuer struct {
+	*httptest.Server
+
+	clientID     string
+	clientSecret string
+	key          *rsa.PrivateKey
+	signer       jose.Signer
+
+	mu     sync.Mutex
+	claims login.Claims
+	codes  map[string]grant
+	tokens map[string]login.Claims
+}
+
+// grant is an authorization code issued by the authorize endpoint.
+type grant struct {
+	claims      login.Claims
+	redirectURI string
+	nonce       string
+	// challenge and method are the PKCE code challenge, if any.
+	challenge string
+	method    string
+	expires   time.Time
+}
+
+// NewIssuer starts and returns a new Issuer for the OAuth 2.0 client with the
+// given credentials. The caller should call Close when finished, to shut it
+// down.
+func NewIssuer(clientID, clientSecret string) *Issuer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic("vippstest: generating signing key: " + err.Error())
+	}
+	signer, err := jose.NewSigner(jose.SigningKey{
+		Algorithm: idTokenSignAlg,
+		Key:       jose.JSONWebKey{Key: key, KeyID: idTokenKeyID},
+	}, (&jose.SignerOptions{}).WithType("JWT"))
+	if err != nil {
+		panic("vippstest: creating signer: " + err.Error())
+	}
+
+	i := &Issuer{
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		key:          key,
+		signer:       signer,
+		claims:       login.Claims{UserID: randomID()},
+		codes:        make(map[string]grant),
+		tokens:       make(map[string]login.Claims),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(issuerPath+".well-known/openid-configuration", i.handleDiscovery)
+	mux.HandleFunc(issuerPath+".well-known/jwks.json", i.handleJWKS)
+	mux.HandleFunc(issuerPath+"oauth2/auth", i.handleAuthorize)
+	mux.HandleFunc(issuerPath+"oauth2/token", i.handleToken)
+	mux.HandleFunc(issuerPath+"userinfo", i.handleUserInfo)
+	i.Server = httptest.NewServer(mux)
+
+	return i
+}
+
+// IssuerURL returns the issuer URL to use in login.ProviderConfig.
+func (i *Issuer) IssuerURL() login.IssuerURL {
+	return login.IssuerURL(i.URL + issuerPath)
+}
+
+// SetClaims sets the claims of the user that approves subsequent
+// authorization requests. If UserID is empty, a random one is used.
+func (i *Issuer) SetClaims(claims login.Claims) {
+	if claims.UserID == "" {
+		claims.UserID = randomID()
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.claims = claims
+}
+
+func (i *Issuer) handleDiscovery(w http.ResponseWriter, r *http.Request) {
+	base := string(i.IssuerURL())
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                base,
+		"authorization_endpoint":                base + "oauth2/auth",
+		"token_endpoint":                        base + "oauth2/token",
+		"userinfo_endpoint":                     base + "userinfo",
+		"jwks_uri":                              base + ".well-known/jwks.json",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{string(idTokenSignAlg)},
+		"token_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post"},
+	})
+}
+
+func (i *Issuer) handleJWKS(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, jose.JSONWebKeySet{Keys: []jose.JSONWebKey{{
+		Key:       &i.key.PublicKey,
+		KeyID:     idTokenKeyID,
+		Algorithm: string(idTokenSignAlg),
+		Use:       "sig",
+	}}})
+}
+
+// handleAuthorize approves the authorization request and redirects back to
+// the client with a code.
+func (i *Issuer) handleAuthorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	redirectURI, err := url.Parse(q.Get("redirect_uri"))
+	switch {
+	case q.Get("client_id") != i.clientID:
+		http.Error(w, "unknown client_id", http.StatusBadRequest)
+		return
+	case q.Get("response_type") != "code":
+		http.Error(w, "unsupported response_type", http.StatusBadRequest)
+		return
+	case err != nil || !redirectURI.IsAbs():
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+	method := q.Get("code_challenge_method")
+	if method == "" && q.Get("code_challenge") != "" {
+		method = "plain"
+	}
+	if method != "" && method != "S256" && method != "plain" {
+		http.Error(w, "unsupported code_challenge_method", http.StatusBadRequest)
+		return
+	}
+
+	code := randomID()
+
+	i.mu.Lock()
+	i.codes[code] = grant{
+		claims:      i.claims,
+		redirectURI: redirectURI.String(),
+		nonce:       q.Get("nonce"),
+		challenge:   q.Get("code_challenge"),
+		method:      method,
+		expires:     time.Now().Add(codeLifetime),
+	}
+	i.mu.Unlock()
+
+	params := redirectURI.Query()
+	params.Set("code", code)
+	if state := q.Get("state"); state != "" {
+		params.Set("state", state)
+	}
+	redirectURI.RawQuery = params.Encode()
+	http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+}
+
+// handleToken exchanges an authorization code for an access token and a
+// signed ID token.
+func (i *Issuer) handleToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "Unsupported method", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		oauthError(w, http.StatusBadRequest, "invalid_request")
+		return
+	}
+	id, secret, ok := r.BasicAuth()
+	if !ok {
+		id, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	if id != i.clientID || secret != i.clientSecret {
+		oauthError(w, http.StatusUnauthorized, "invalid_client")
+		return
+	}
+	if r.PostForm.Get("grant_type") != "authorization_code" {
+		oauthError(w, http.StatusBadRequest, "unsupported_grant_type")
+		return
+	}
+
+	code := r.PostForm.Get("code")
+
+	i.mu.Lock()
+	g, ok := i.codes[code]
+	delete(i.codes, code)
+	i.mu.Unlock()
+
+	if !ok || time.Now().After(g.expires) || r.PostForm.Get("redirect_uri") != g.redirectURI ||
+		!g.verify(r.PostForm.Get("code_verifier")) {
+		oauthError(w, http.StatusBadRequest, "invalid_grant")
+		return
+	}
+
+	idToken, err := i.signIDToken(g)
+	if err != nil {
+		oauthError(w, http.StatusInternalServerError, "server_error")
+		return
+	}
+	accessToken := randomID()
+
+	i.mu.Lock()
+	i.tokens[accessToken] = g.claims
+	i.mu.Unlock()
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"expires_in":   int(tokenLifetime.Seconds()),
+		"id_token":     idToken,
+	})
+}
+
+// verify reports whether verifier matches the PKCE code challenge of g, if
+// any.
+func (g grant) verify(verifier string) bool {
+	if g.method == "" {
+		return true
+	}
+	if verifier == "" {
+		return false
+	}
+	if g.method == "S256" {
+		sum := sha256.Sum256([]byte(verifier))
+		verifier = base64.RawURLEncoding.EncodeToString(sum[:])
+	}
+	return subtle.ConstantTimeCompare([]byte(verifier), []byte(g.challenge)) == 1
+}
+
+func (i *Issuer) signIDToken(g grant) (string, error) {
+	now := time.Now()
+	claims := map[string]interface{}{
+		"iss": string(i.IssuerURL()),
+		"sub": g.claims.UserID,
+		"aud": i.clientID,
+		"iat": now.Unix(),
+		"exp": now.Add(tokenLifetime).Unix(),
+	}
+	if g.nonce != "" {
+		claims["nonce"] = g.nonce
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	jws, err := i.signer.Sign(payload)
+	if err != nil {
+		return "", err
+	}
+	return jws.CompactSerialize()
+}
+
+// handleUserInfo returns the claims of the user that the bearer token was
+// issued to.
+func (i *Issuer) handleUserInfo(w http.ResponseWriter, r *http.Request) {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+	i.mu.Lock()
+	claims, ok := i.tokens[token]
+	i.mu.Unlock()
+
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	writeJSON(w, http.StatusOK, claims)
+}
+
+func oauthError(w http.ResponseWriter, status int, code string) {
+	writeJSON(w, status, map[string]string{"error": code})
+}
@@ -0,0 +1,539 @@
+package vippstest
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/torfjor/go-vipps"
+	"github.com/torfjor/go-vipps/recurring"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	recurringEndpoint = "recurring/v2/agreements"
+	// minDueDays is the minimum number of days between creating a Charge and
+	// its due date.
+	minDueDays = 2
+	// dueNotice is how long before its due date a pending Charge becomes due.
+	dueNotice = 24 * time.Hour
+)
+
+// Codes used in error responses from the Recurring API fake. They are
+// synthetic, as the Recurring v2 API does not document its codes, and package
+// recurring does not classify errors by them.
+const (
+	codeNotFound             = "not_found"
+	codeInvalid              = "invalid"
+	codeAgreementNotActive   = "agreement_not_active"
+	codeAgreementNotPending  = "agreement_not_pending"
+	codeChargeNotCancellable = "charge_not_cancellable"
+	codeChargeNotCapturable  = "charge_not_capturable"
+	codeChargeNotRefundable  = "charge_not_refundable"
+	codeRefundExceeds        = "refund_amount_too_large"
+)
+
+// agreement is the state kept for a Vipps recurring Agreement.
+type agreement struct {
+	recurring.Agreement
+	initialCharge recurring.InitialCharge
+	charges       map[string]*charge
+	// order is the creation order of charges, to list them stably.
+	order []string
+}
+
+// charge is the state kept for a Charge on an Agreement.
+type charge struct {
+	recurring.Charge
+	retryDays int
+	fail      bool
+}
+
+// recurringError returns a reply shaped like recurring.ErrRecurring.
+func recurringError(status int, field, code, message string) reply {
+	return reply{status, recurring.ErrRecurring{{
+		Field:     field,
+		Code:      code,
+		Message:   message,
+		ContextID: randomID(),
+	}}}
+}
+
+func notFound(field, id string) reply {
+	return recurringError(http.StatusNotFound, field, codeNotFound, fmt.Sprintf("%s %q not found", field, id))
+}
+
+func invalid(field, message string) reply {
+	return recurringError(http.StatusBadRequest, field, codeInvalid, message)
+}
+
+// handleRecurring routes requests for the Recurring v2 agreement endpoints.
+func (s *Server) handleRecurring(w http.ResponseWriter, r *http.Request) {
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/"+recurringEndpoint), "/")
+	var segments []string
+	if rest != "" {
+		segments = strings.Split(rest, "/")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.processCharges()
+
+	key := r.Header.Get("Idempotency-Key")
+	if key != "" {
+		key = r.Method + " " + r.URL.Path + " " + key
+		if res, ok := s.replies[key]; ok {
+			writeJSON(w, res.status, res.body)
+			return
+		}
+	}
+
+	var res reply
+	switch n := len(segments); {
+	case n == 0 && r.Method == http.MethodPost:
+		res = s.createAgreement(r)
+	case n == 0 && r.Method == http.MethodGet:
+		res = s.listAgreements(recurring.AgreementStatus(r.URL.Query().Get("status")))
+	case n == 1 && r.Method == http.MethodGet:
+		res = s.getAgreement(segments[0])
+	case n == 1 && r.Method == http.MethodPatch:
+		res = s.updateAgreement(segments[0], r)
+	case n == 2 && segments[1] == "charges" && r.Method == http.MethodPost:
+		res = s.createCharge(segments[0], r)
+	case n == 2 && segments[1] == "charges" && r.Method == http.MethodGet:
+		res = s.listCharges(segments[0], recurring.ChargeStatus(r.URL.Query().Get("chargeStatus")))
+	case n == 3 && segments[1] == "charges" && r.Method == http.MethodGet:
+		res = s.getCharge(segments[0], segments[2])
+	case n == 3 && segments[1] == "charges" && r.Method == http.MethodDelete:
+		res = s.cancelCharge(segments[0], segments[2])
+	case n == 4 && segments[1] == "charges" && segments[3] == "capture" && r.Method == http.MethodPost:
+		res = s.captureCharge(segments[0], segments[2])
+	case n == 4 && segments[1] == "charges" && segments[3] == "refund" && r.Method == http.MethodPost:
+		res = s.refundCharge(segments[0], segments[2], r)
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	if key != "" && r.Method != http.MethodGet {
+		s.replies[key] = res
+	}
+	writeJSON(w, res.status, res.body)
+}
+
+func (s *Server) createAgreement(r *http.Request) reply {
+	var cmd recurring.CreateAgreementCommand
+	if err := json.NewDecoder(r.Body).Decode(&cmd); err != nil {
+		return invalid("", err.Error())
+	}
+	switch {
+	case cmd.Price.Minor <= 0:
+		return invalid("price", "must be positive")
+	case cmd.ProductName == "":
+		return invalid("productName", "is required")
+	case cmd.RedirectURL == "":
+		return invalid("merchantRedirectUrl", "is required")
+	case cmd.AgreementURL == "":
+		return invalid("merchantAgreementUrl", "is required")
+	case cmd.Currency != recurring.CurrencyNOK:
+		return invalid("currency", "must be NOK")
+	case cmd.IntervalCount < 1 || cmd.IntervalCount > 31:
+		return invalid("intervalCount", "must be between 1 and 31")
+	case cmd.Campaign != nil && cmd.Campaign.Price.Minor >= cmd.Price.Minor:
+		return invalid("campaign.campaignPrice", "must be lower than price")
+	}
+	switch cmd.Interval {
+	case recurring.ChargeIntervalDay, recurring.ChargeIntervalWeek, recurring.ChargeIntervalMonth:
+	default:
+		return invalid("interval", "must be one of DAY, WEEK or MONTH")
+	}
+
+	id := "agr_" + randomID()[:7]
+	s.agreements[id] = &agreement{
+		Agreement: recurring.Agreement{
+			Campaign:           cmd.Campaign,
+			Currency:           cmd.Currency,
+			ID:                 id,
+			Interval:           cmd.Interval,
+			IntervalCount:      cmd.IntervalCount,
+			Price:              cmd.Price,
+			ProductName:        cmd.ProductName,
+			ProductDescription: cmd.ProductDescription,
+			Status:             recurring.AgreementStatusPending,
+		},
+		initialCharge: cmd.InitialCharge,
+		charges:       make(map[string]*charge),
+	}
+	s.agreementOrder = append(s.agreementOrder, id)
+
+	return reply{http.StatusCreated, recurring.AgreementReference{
+		AgreementResource: fmt.Sprintf("%s/%s/%s", s.URL, recurringEndpoint, id),
+		AgreementID:       id,
+		URL:               fmt.Sprintf("%s/landing?agreementId=%s", s.URL, id),
+	}}
+}
+
+func (s *Server) listAgreements(status recurring.AgreementStatus) reply {
+	res := make([]recurring.Agreement, 0)
+	for _, id := range s.agreementOrder {
+		a := s.agreements[id]
+		if status == "" || a.Status == status {
+			res = append(res, a.Agreement)
+		}
+	}
+	return reply{http.StatusOK, res}
+}
+
+func (s *Server) getAgreement(id string) reply {
+	a, ok := s.agreements[id]
+	if !ok {
+		return notFound("agreementId", id)
+	}
+	return reply{http.StatusOK, a.Agreement}
+}
+
+func (s *Server) updateAgreement(id string, r *http.Request) reply {
+	a, ok := s.agreements[id]
+	if !ok {
+		return notFound("agreementId", id)
+	}
+	var cmd recurring.UpdateAgreementCommand
+	if err := json.NewDecoder(r.Body).Decode(&cmd); err != nil {
+		return invalid("", err.Error())
+	}
+	if a.Status != recurring.AgreementStatusPending && a.Status != recurring.AgreementStatusActive {
+		return recurringError(http.StatusBadRequest, "status", codeAgreementNotActive,
+			fmt.Sprintf("agreement is %s and cannot be updated", a.Status))
+	}
+	switch cmd.Status {
+	case "":
+	case recurring.AgreementStatusStopped:
+		now := s.now()
+		a.Status = recurring.AgreementStatusStopped
+		a.End = &now
+	default:
+		return invalid("status", "can only be changed to STOPPED")
+	}
+
+	price := a.Price
+	if cmd.Price != nil && !cmd.Price.IsZero() {
+		price = *cmd.Price
+	}
+	campaign := a.Campaign
+	if cmd.Campaign != nil {
+		campaign = cmd.Campaign
+	}
+	if campaign != nil && campaign.Price.Minor >= price.Minor {
+		return invalid("campaign.campaignPrice", "must be lower than price")
+	}
+	a.Price, a.Campaign = price, campaign
+	if cmd.ProductName != "" {
+		a.ProductName = cmd.ProductName
+	}
+	if cmd.ProductDescription != "" {
+		a.ProductDescription = cmd.ProductDescription
+	}
+
+	return reply{http.StatusOK, map[string]string{"agreementId": id}}
+}
+
+func (s *Server) createCharge(agreementID string, r *http.Request) reply {
+	a, ok := s.agreements[agreementID]
+	if !ok {
+		return notFound("agreementId", agreementID)
+	}
+	var cmd struct {
+		Amount      int64              `json:"amount"`
+		Currency    recurring.Currency `json:"currency"`
+		Description string             `json:"description"`
+		Due         string             `json:"due"`
+		RetryDays   int                `json:"retryDays"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&cmd); err != nil {
+		return invalid("", err.Error())
+	}
+	if a.Status != recurring.AgreementStatusActive {
+		return recurringError(http.StatusBadRequest, "agreementId", codeAgreementNotActive,
+			fmt.Sprintf("agreement is %s, charges can only be created for ACTIVE agreements", a.Status))
+	}
+	due, err := time.Parse("2006-01-02", cmd.Due)
+	if err != nil {
+		return invalid("due", "must be a date of the form YYYY-MM-DD")
+	}
+	switch {
+	case cmd.Amount <= 0:
+		return invalid("amount", "must be positive")
+	case cmd.Description == "":
+		return invalid("description", "is required")
+	case cmd.RetryDays < 0 || cmd.RetryDays > 14:
+		return invalid("retryDays", "must be between 0 and 14")
+	case due.Before(startOfDay(s.now()).AddDate(0, 0, minDueDays)):
+		return invalid("due", fmt.Sprintf("must be at least %d days in the future", minDueDays))
+	}
+
+	c := a.addCharge(recurring.Charge{
+		Amount:      vipps.Ore(cmd.Amount),
+		Description: cmd.Description,
+		Due:         due,
+		Status:      recurring.ChargeStatusPending,
+		Type:        recurring.ChargeTypeRecurring,
+	})
+	c.retryDays = cmd.RetryDays
+
+	return reply{http.StatusCreated, recurring.ChargeReference{ChargeID: c.ID}}
+}
+
+func (a *agreement) addCharge(ch recurring.Charge) *charge {
+	ch.ID = "chr_" + randomID()[:7]
+	c := &charge{Charge: ch}
+	a.charges[c.ID] = c
+	a.order = append(a.order, c.ID)
+	return c
+}
+
+func (s *Server) listCharges(agreementID string, status recurring.ChargeStatus) reply {
+	a, ok := s.agreements[agreementID]
+	if !ok {
+		return notFound("agreementId", agreementID)
+	}
+	res := make([]recurring.Charge, 0)
+	for _, id := range a.order {
+		c := a.charges[id]
+		if status == "" || c.Status == status {
+			res = append(res, c.Charge)
+		}
+	}
+	return reply{http.StatusOK, res}
+}
+
+// findCharge looks up a Charge, or returns a not found reply.
+func (s *Server) findCharge(agreementID, chargeID string) (*charge, *reply) {
+	a, ok := s.agreements[agreementID]
+	if !ok {
+		res := notFound("agreementId", agreementID)
+		return nil, &res
+	}
+	c, ok := a.charges[chargeID]
+	if !ok {
+		res := notFound("chargeId", chargeID)
+		return nil, &res
+	}
+	return c, nil
+}
+
+func (s *Server) getCharge(agreementID, chargeID string) reply {
+	c, res := s.findCharge(agreementID, chargeID)
+	if res != nil {
+		return *res
+	}
+	return reply{http.StatusOK, c.Charge}
+}
+
+func (s *Server) cancelCharge(agreementID, chargeID string) reply {
+	c, res := s.findCharge(agreementID, chargeID)
+	if res != nil {
+		return *res
+	}
+	switch c.Status {
+	case recurring.ChargeStatusPending, recurring.ChargeStatusDue, recurring.ChargeStatusReserved:
+		c.Status = recurring.ChargeStatusCancelled
+	default:
+		return recurringError(http.StatusBadRequest, "chargeId", codeChargeNotCancellable,
+			fmt.Sprintf("charge is %s and cannot be cancelled", c.Status))
+	}
+	return reply{http.StatusOK, c.Charge}
+}
+
+func (s *Server) captureCharge(agreementID, chargeID string) reply {
+	c, res := s.findCharge(agreementID, chargeID)
+	if res != nil {
+		return *res
+	}
+	if c.Status != recurring.ChargeStatusReserved {
+		return recurringError(http.StatusBadRequest, "chargeId", codeChargeNotCapturable,
+			fmt.Sprintf("charge is %s, only RESERVED charges can be captured", c.Status))
+	}
+	c.Status = recurring.ChargeStatusCharged
+	c.TransactionID = s.transactionID()
+	return reply{http.StatusNoContent, nil}
+}
+
+func (s *Server) refundCharge(agreementID, chargeID string, r *http.Request) reply {
+	c, res := s.findCharge(agreementID, chargeID)
+	if res != nil {
+		return *res
+	}
+	var cmd struct {
+		Amount      int64  `json:"amount"`
+		Description string `json:"description"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&cmd); err != nil {
+		return invalid("", err.Error())
+	}
+	if c.Status != recurring.ChargeStatusCharged && c.Status != recurring.ChargeStatusPartiallyRefunded {
+		return recurringError(http.StatusBadRequest, "chargeId", codeChargeNotRefundable,
+			fmt.Sprintf("charge is %s and cannot be refunded", c.Status))
+	}
+	switch {
+	case cmd.Amount <= 0:
+		return invalid("amount", "must be positive")
+	case cmd.Description == "":
+		return invalid("description", "is required")
+	case cmd.Amount > c.Amount.Minor-c.AmountRefunded.Minor:
+		return recurringError(http.StatusBadRequest, "amount", codeRefundExceeds,
+			fmt.Sprintf("cannot refund more than the remaining %d", c.Amount.Minor-c.AmountRefunded.Minor))
+	}
+	c.AmountRefunded = vipps.Ore(c.AmountRefunded.Minor + cmd.Amount)
+	if c.AmountRefunded.Minor == c.Amount.Minor {
+		c.Status = recurring.ChargeStatusRefunded
+	} else {
+		c.Status = recurring.ChargeStatusPartiallyRefunded
+	}
+	return reply{http.StatusNoContent, nil}
+}
+
+// processCharges moves charges along according to the clock. Pending charges
+// become due dueNotice before their due date, and are charged on it. Charges
+// marked to fail stay due for their retry days, and then fail. s.mu must be
+// held.
+func (s *Server) processCharges() {
+	now := s.now()
+	for _, a := range s.agreements {
+		for _, c := range a.charges {
+			if c.Status == recurring.ChargeStatusPending && !now.Before(c.Due.Add(-dueNotice)) {
+				c.Status = recurring.ChargeStatusDue
+			}
+			if c.Status != recurring.ChargeStatusDue || now.Before(c.Due) {
+				continue
+			}
+			switch {
+			case a.Status != recurring.AgreementStatusActive:
+				c.Status = recurring.ChargeStatusFailed
+			case !c.fail:
+				c.Status = recurring.ChargeStatusCharged
+				c.TransactionID = s.transactionID()
+			case !now.Before(c.Due.AddDate(0, 0, c.retryDays+1)):
+				c.Status = recurring.ChargeStatusFailed
+			}
+		}
+	}
+}
+
+// Agreement returns the current state of the Agreement with the given id.
+func (s *Server) Agreement(agreementID string) (*recurring.Agreement, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a, ok := s.agreements[agreementID]
+	if !ok {
+		return nil, false
+	}
+	res := a.Agreement
+	return &res, true
+}
+
+// ApproveAgreement simulates the user accepting a pending Agreement in the
+// Vipps app. The Agreement becomes ACTIVE, and its initial charge, if any, is
+// charged or reserved depending on its transaction type.
+func (s *Server) ApproveAgreement(agreementID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a, err := s.pendingAgreement(agreementID)
+	if err != nil {
+		return err
+	}
+	now := s.now()
+	a.Status = recurring.AgreementStatusActive
+	a.Start = &now
+
+	if ic := a.initialCharge; ic.Amount.Minor > 0 {
+		status := recurring.ChargeStatusCharged
+		if ic.TransactionType == recurring.TransactionTypeReserveCapture {
+			status = recurring.ChargeStatusReserved
+		}
+		a.addCharge(recurring.Charge{
+			Amount:        ic.Amount,
+			Description:   ic.Description,
+			Due:           now,
+			Status:        status,
+			TransactionID: s.transactionID(),
+			Type:          recurring.ChargeTypeInitial,
+		})
+	}
+	return nil
+}
+
+// RejectAgreement simulates the user rejecting a pending Agreement in the
+// Vipps app. The Agreement becomes STOPPED.
+func (s *Server) RejectAgreement(agreementID string) error {
+	return s.endPendingAgreement(agreementID, recurring.AgreementStatusStopped)
+}
+
+// ExpireAgreement simulates a pending Agreement timing out before the user
+// acted on it. The Agreement becomes EXPIRED.
+func (s *Server) ExpireAgreement(agreementID string) error {
+	return s.endPendingAgreement(agreementID, recurring.AgreementStatusExpired)
+}
+
+func (s *Server) endPendingAgreement(agreementID string, status recurring.AgreementStatus) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a, err := s.pendingAgreement(agreementID)
+	if err != nil {
+		return err
+	}
+	now := s.now()
+	a.Status = status
+	a.End = &now
+	return nil
+}
+
+func (s *Server) pendingAgreement(agreementID string) (*agreement, error) {
+	a, ok := s.agreements[agreementID]
+	if !ok {
+		return nil, fmt.Errorf("vippstest: agreement %q not found", agreementID)
+	}
+	if a.Status != recurring.AgreementStatusPending {
+		return nil, fmt.Errorf("vippstest: agreement %q is %s, not PENDING", agreementID, a.Status)
+	}
+	return a, nil
+}
+
+// FailCharge makes the Charge fail when it is processed, as if the user's card
+// was declined. The Charge stays DUE for its retry days before it is FAILED.
+func (s *Server) FailCharge(agreementID, chargeID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, res := s.findCharge(agreementID, chargeID)
+	if res != nil {
+		return fmt.Errorf("vippstest: charge %q on agreement %q not found", chargeID, agreementID)
+	}
+	c.fail = true
+	return nil
+}
+
+// Now returns the current time of the Server's clock.
+func (s *Server) Now() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.now()
+}
+
+// Advance moves the Server's clock forward by d, and processes charges that
+// become due or are charged in the meantime.
+func (s *Server) Advance(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.clockOffset += d
+	s.processCharges()
+}
+
+func startOfDay(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
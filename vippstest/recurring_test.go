@@ -0,0 +1,313 @@
+package vippstest_test
+
+import (
+	"context"
+	"errors"
+	"github.com/torfjor/go-vipps"
+	"github.com/torfjor/go-vipps/recurring"
+	"github.com/torfjor/go-vipps/vippstest"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func newRecurringClient(t *testing.T) (*vippstest.Server, *recurring.Client) {
+	t.Helper()
+	srv := vippstest.NewServer(vipps.Credentials{})
+	t.Cleanup(srv.Close)
+
+	return srv, recurring.NewClient(vipps.ClientConfig{HTTPClient: srv.Client(), BaseURL: srv.URL})
+}
+
+// createAgreement creates a monthly agreement, with an initial charge of
+// transactionType if it is not empty.
+func createAgreement(t *testing.T, client *recurring.Client, transactionType recurring.TransactionType) string {
+	t.Helper()
+	cmd := recurring.CreateAgreementCommand{
+		Currency:      recurring.CurrencyNOK,
+		Interval:      recurring.ChargeIntervalMonth,
+		IntervalCount: 1,
+		AgreementURL:  "https://example.com/agreement",
+		RedirectURL:   "https://example.com/redirect",
+		Price:         vipps.Ore(9900),
+		ProductName:   "Subscription",
+	}
+	if transactionType != "" {
+		cmd.InitialCharge = recurring.InitialCharge{
+			Amount:          vipps.Ore(4900),
+			Currency:        recurring.CurrencyNOK,
+			Description:     "First month",
+			TransactionType: transactionType,
+		}
+	}
+	ref, err := client.CreateAgreement(context.Background(), cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ref.AgreementID
+}
+
+// createCharge creates a charge on agreementID, due days from the Server's
+// current date.
+func createCharge(t *testing.T, srv *vippstest.Server, client *recurring.Client, agreementID string, days, retryDays int, key string) *recurring.ChargeReference {
+	t.Helper()
+	y, m, d := srv.Now().Date()
+	ref, err := client.CreateCharge(context.Background(), recurring.CreateChargeCommand{
+		IdempotencyKey: key,
+		AgreementID:    agreementID,
+		Amount:         vipps.Ore(9900),
+		Currency:       recurring.CurrencyNOK,
+		Description:    "Monthly",
+		Due:            recurring.DueDate{Time: time.Date(y, m, d+days, 0, 0, 0, 0, time.UTC)},
+		RetryDays:      retryDays,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ref
+}
+
+func charge(t *testing.T, client *recurring.Client, agreementID, chargeID string) *recurring.Charge {
+	t.Helper()
+	c, err := client.GetCharge(context.Background(), recurring.GetChargeCommand{
+		ChargeIdentifier: recurring.ChargeIdentifier{AgreementID: agreementID, ChargeID: chargeID},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestRecurringAgreementLifecycle(t *testing.T) {
+	srv, client := newRecurringClient(t)
+	ctx := context.Background()
+
+	id := createAgreement(t, client, recurring.TransactionTypeDirectCapture)
+	if a, _ := srv.Agreement(id); a.Status != recurring.AgreementStatusPending {
+		t.Fatalf("status = %s, want %s", a.Status, recurring.AgreementStatusPending)
+	}
+	if _, err := client.CreateCharge(ctx, recurring.CreateChargeCommand{
+		AgreementID: id,
+		Amount:      vipps.Ore(100),
+		Description: "Too early",
+		Due:         recurring.DueDate{Time: srv.Now().AddDate(0, 0, 3)},
+	}); err == nil {
+		t.Error("CreateCharge on a PENDING agreement succeeded, want error")
+	}
+
+	if err := srv.ApproveAgreement(id); err != nil {
+		t.Fatal(err)
+	}
+	a, err := client.GetAgreement(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Status != recurring.AgreementStatusActive || a.Start == nil {
+		t.Errorf("agreement = %+v, want ACTIVE with a start", a)
+	}
+	charges, err := client.ListCharges(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(charges) != 1 || charges[0].Type != recurring.ChargeTypeInitial || charges[0].Status != recurring.ChargeStatusCharged ||
+		charges[0].Amount != vipps.Ore(4900) {
+		t.Errorf("charges = %+v, want one CHARGED initial charge", charges)
+	}
+
+	if _, err := client.UpdateAgreement(ctx, recurring.UpdateAgreementCommand{AgreementID: id, Status: recurring.AgreementStatusStopped}); err != nil {
+		t.Fatal(err)
+	}
+	a, err = client.GetAgreement(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Status != recurring.AgreementStatusStopped || a.End == nil {
+		t.Errorf("agreement = %+v, want STOPPED with an end", a)
+	}
+	if err := srv.ApproveAgreement(id); err == nil {
+		t.Error("ApproveAgreement on a STOPPED agreement succeeded, want error")
+	}
+	_, err = client.UpdateAgreement(ctx, recurring.UpdateAgreementCommand{AgreementID: id, ProductName: "Renamed"})
+	var apiErr *vipps.APIError
+	if !errors.As(err, &apiErr) || apiErr.Status != http.StatusBadRequest {
+		t.Errorf("UpdateAgreement on a STOPPED agreement = %v, want a 400 response", err)
+	}
+}
+
+func TestRecurringEndPendingAgreement(t *testing.T) {
+	srv, client := newRecurringClient(t)
+	tests := []struct {
+		name string
+		end  func(id string) error
+		want recurring.AgreementStatus
+	}{
+		{"rejected", srv.RejectAgreement, recurring.AgreementStatusStopped},
+		{"expired", srv.ExpireAgreement, recurring.AgreementStatusExpired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id := createAgreement(t, client, "")
+			if err := tt.end(id); err != nil {
+				t.Fatal(err)
+			}
+			a, _ := srv.Agreement(id)
+			if a.Status != tt.want || a.End == nil {
+				t.Errorf("agreement = %+v, want %s with an end", a, tt.want)
+			}
+			if err := srv.ApproveAgreement(id); err == nil {
+				t.Error("ApproveAgreement succeeded, want error")
+			}
+		})
+	}
+}
+
+func TestRecurringChargeProcessing(t *testing.T) {
+	type step struct {
+		// sinceDue is the time after the due date of the charge to move the
+		// clock to.
+		sinceDue time.Duration
+		want     recurring.ChargeStatus
+	}
+	day := 24 * time.Hour
+	tests := []struct {
+		name      string
+		retryDays int
+		fail      bool
+		stop      bool
+		steps     []step
+	}{
+		{
+			name: "charged",
+			steps: []step{
+				{-36 * time.Hour, recurring.ChargeStatusPending},
+				{-12 * time.Hour, recurring.ChargeStatusDue},
+				{0, recurring.ChargeStatusCharged},
+			},
+		},
+		{
+			name:      "failed after retries",
+			retryDays: 2,
+			fail:      true,
+			steps: []step{
+				{-12 * time.Hour, recurring.ChargeStatusDue},
+				{0, recurring.ChargeStatusDue},
+				{2 * day, recurring.ChargeStatusDue},
+				{3 * day, recurring.ChargeStatusFailed},
+			},
+		},
+		{
+			name: "agreement stopped",
+			stop: true,
+			steps: []step{
+				{-12 * time.Hour, recurring.ChargeStatusDue},
+				{0, recurring.ChargeStatusFailed},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, client := newRecurringClient(t)
+			id := createAgreement(t, client, "")
+			if err := srv.ApproveAgreement(id); err != nil {
+				t.Fatal(err)
+			}
+			ref := createCharge(t, srv, client, id, 3, tt.retryDays, "")
+			due := charge(t, client, id, ref.ChargeID).Due
+			if tt.fail {
+				if err := srv.FailCharge(id, ref.ChargeID); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.stop {
+				if _, err := client.UpdateAgreement(context.Background(), recurring.UpdateAgreementCommand{
+					AgreementID: id,
+					Status:      recurring.AgreementStatusStopped,
+				}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			for _, s := range tt.steps {
+				srv.Advance(due.Add(s.sinceDue).Sub(srv.Now()))
+				c := charge(t, client, id, ref.ChargeID)
+				if c.Status != s.want {
+					t.Errorf("%v after due: status = %s, want %s", s.sinceDue, c.Status, s.want)
+				}
+				if (c.Status == recurring.ChargeStatusCharged) != (c.TransactionID != "") {
+					t.Errorf("%v after due: transaction id = %q for status %s", s.sinceDue, c.TransactionID, c.Status)
+				}
+			}
+		})
+	}
+}
+
+func TestRecurringReserveCapture(t *testing.T) {
+	srv, client := newRecurringClient(t)
+	ctx := context.Background()
+
+	id := createAgreement(t, client, recurring.TransactionTypeReserveCapture)
+	if err := srv.ApproveAgreement(id); err != nil {
+		t.Fatal(err)
+	}
+	charges, err := client.ListCharges(ctx, id, recurring.ChargeStatusReserved)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(charges) != 1 {
+		t.Fatalf("reserved charges = %+v, want the initial charge", charges)
+	}
+	chargeID := recurring.ChargeIdentifier{AgreementID: id, ChargeID: charges[0].ID}
+
+	if err := client.CaptureCharge(ctx, recurring.CaptureChargeCommand{ChargeIdentifier: chargeID}); err != nil {
+		t.Fatal(err)
+	}
+	if c := charge(t, client, id, chargeID.ChargeID); c.Status != recurring.ChargeStatusCharged {
+		t.Errorf("status = %s, want %s", c.Status, recurring.ChargeStatusCharged)
+	}
+	if _, err := client.CancelCharge(ctx, recurring.DeleteChargeCommand{ChargeIdentifier: chargeID}); err == nil {
+		t.Error("CancelCharge on a CHARGED charge succeeded, want error")
+	}
+}
+
+func TestRecurringIdempotencyKeyReplay(t *testing.T) {
+	srv, client := newRecurringClient(t)
+	ctx := context.Background()
+
+	id := createAgreement(t, client, "")
+	if err := srv.ApproveAgreement(id); err != nil {
+		t.Fatal(err)
+	}
+
+	first := createCharge(t, srv, client, id, 3, 0, "charge-1")
+	retried := createCharge(t, srv, client, id, 3, 0, "charge-1")
+	if retried.ChargeID != first.ChargeID {
+		t.Errorf("retried charge id = %q, want %q", retried.ChargeID, first.ChargeID)
+	}
+	if other := createCharge(t, srv, client, id, 3, 0, "charge-2"); other.ChargeID == first.ChargeID {
+		t.Errorf("charge with a new key has id %q of the first", other.ChargeID)
+	}
+	charges, err := client.ListCharges(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(charges) != 2 {
+		t.Errorf("charges = %d, want 2", len(charges))
+	}
+
+	srv.Advance(charge(t, client, id, first.ChargeID).Due.Sub(srv.Now()))
+	refund := recurring.RefundChargeCommand{
+		ChargeIdentifier: recurring.ChargeIdentifier{AgreementID: id, ChargeID: first.ChargeID},
+		IdempotencyKey:   "refund-1",
+		Amount:           vipps.Ore(1000),
+		Description:      "Partial refund",
+	}
+	for i := 0; i < 2; i++ {
+		if err := client.RefundCharge(ctx, refund); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c := charge(t, client, id, first.ChargeID)
+	if c.AmountRefunded != vipps.Ore(1000) || c.Status != recurring.ChargeStatusPartiallyRefunded {
+		t.Errorf("charge = %+v, want %v refunded once", c, vipps.Ore(1000))
+	}
+}
@@ -0,0 +1,214 @@
+// Package vippstest provides an in-process fake of the Vipps APIs for use in
+// tests.
+//
+// A Server keeps real per-order state and answers with the same payloads and
+// error shapes as Vipps, so code built on the ecom package can be tested
+// without network access to the Vipps test environment. It serves the Ecom v2
+// and Recurring v2 APIs, and has a controllable clock to move recurring
+// charges past their due date:
+//
+//	srv := vippstest.NewServer(vipps.Credentials{})
+//	defer srv.Close()
+//
+//	client := ecom.NewClient(vipps.ClientConfig{HTTPClient: srv.Client(), BaseURL: srv.URL})
+//
+// Clients validate commands before sending them, and reject callback URLs that
+// are not https. Set SkipValidation in the vipps.ClientConfig to have the
+// Server deliver callbacks to a plain httptest.Server.
+//
+// An Issuer stands in for the Vipps Login OpenID Connect issuer, so that the
+// login package can be exercised end-to-end as well.
+//
+// Ecom errors carry the error codes documented by Vipps. The Recurring v2 API
+// does not document its error codes, so the codes of Recurring errors, e.g.
+// `agreement_not_active`, are synthetic: only their shape and HTTP status
+// match Vipps, and code under test should not branch on them.
+//
+// If the Server is created with non-empty Credentials, API requests must carry
+// the matching subscription key and a bearer token obtained from the
+// `/accessToken/get` endpoint, just like against Vipps. Point the auth client
+// at it with auth.WithBaseURL(srv.URL).
+package vippstest
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/torfjor/go-vipps"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	tokenEndpoint = "/accessToken/get"
+	tokenLifetime = time.Hour
+)
+
+// Server is a fake Vipps API server listening on a local loopback address.
+type Server struct {
+	*httptest.Server
+
+	credentials vipps.Credentials
+	callbacks   *http.Client
+
+	mu             sync.Mutex
+	clockOffset    time.Duration
+	tokens         map[string]time.Time
+	payments       map[string]*payment
+	agreements     map[string]*agreement
+	agreementOrder []string
+	replies        map[string]reply
+	nextTxID       int
+}
+
+// NewServer starts and returns a new Server. The caller should call Close when
+// finished, to shut it down.
+func NewServer(credentials vipps.Credentials) *Server {
+	s := &Server{
+		credentials: credentials,
+		callbacks:   &http.Client{Timeout: 10 * time.Second},
+		tokens:      make(map[string]time.Time),
+		payments:    make(map[string]*payment),
+		agreements:  make(map[string]*agreement),
+		replies:     make(map[string]reply),
+		nextTxID:    1000000000,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(tokenEndpoint, s.handleToken)
+	mux.Handle("/"+ecomEndpoint, s.authorize(http.HandlerFunc(s.handleEcom)))
+	mux.Handle("/"+ecomEndpoint+"/", s.authorize(http.HandlerFunc(s.handleEcom)))
+	mux.Handle("/"+recurringEndpoint, s.authorize(http.HandlerFunc(s.handleRecurring)))
+	mux.Handle("/"+recurringEndpoint+"/", s.authorize(http.HandlerFunc(s.handleRecurring)))
+	s.Server = httptest.NewServer(mux)
+
+	return s
+}
+
+// handleToken issues access tokens in the format of the Vipps
+// `/accessToken/get` endpoint.
+func (s *Server) handleToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "Unsupported method", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.enforceAuth() {
+		id, secret := r.Header.Get("client_id"), r.Header.Get("client_secret")
+		if id == "" {
+			id, secret, _ = r.BasicAuth()
+		}
+		if id != s.credentials.ClientID || secret != s.credentials.ClientSecret ||
+			r.Header.Get("Ocp-Apim-Subscription-Key") != s.credentials.APISubscriptionKey {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	token := randomID()
+	now := time.Now()
+	expiresOn := now.Add(tokenLifetime)
+
+	s.mu.Lock()
+	s.tokens[token] = expiresOn
+	s.mu.Unlock()
+
+	lifetime := strconv.Itoa(int(tokenLifetime.Seconds()))
+	writeJSON(w, http.StatusOK, map[string]string{
+		"token_type":     "Bearer",
+		"expires_in":     lifetime,
+		"ext_expires_in": lifetime,
+		"expires_on":     strconv.FormatInt(expiresOn.Unix(), 10),
+		"not_before":     strconv.FormatInt(now.Unix(), 10),
+		"resource":       "00000002-0000-0000-c000-000000000000",
+		"access_token":   token,
+	})
+}
+
+// authorize rejects requests without a valid subscription key and bearer
+// token, when the Server has credentials.
+func (s *Server) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.enforceAuth() {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if r.Header.Get("Ocp-Apim-Subscription-Key") != s.credentials.APISubscriptionKey {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+		s.mu.Lock()
+		expiresOn, ok := s.tokens[token]
+		s.mu.Unlock()
+
+		if !ok || time.Now().After(expiresOn) {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) enforceAuth() bool {
+	return s.credentials != vipps.Credentials{}
+}
+
+// now returns the current time of the Server's clock. s.mu must be held.
+func (s *Server) now() time.Time {
+	return time.Now().UTC().Add(s.clockOffset)
+}
+
+// transactionID returns a new unique transaction id. s.mu must be held.
+func (s *Server) transactionID() string {
+	s.nextTxID++
+	return strconv.Itoa(s.nextTxID)
+}
+
+// postCallback sends v as JSON to url, with authToken as the `Authorization`
+// header if set.
+func (s *Server) postCallback(url, authToken string, v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if authToken != "" {
+		req.Header.Set("Authorization", authToken)
+	}
+	resp, err := s.callbacks.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < http.StatusOK || resp.StatusCode > 299 {
+		return vipps.ErrUnexpectedResponse{Status: resp.StatusCode}
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	if v == nil {
+		w.WriteHeader(status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func randomID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
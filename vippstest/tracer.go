@@ -0,0 +1,100 @@
+package vippstest
+
+import (
+	"context"
+	"github.com/torfjor/go-vipps"
+	"sync"
+)
+
+// Tracer is an in-memory vipps.Tracer that records the spans it starts, to
+// assert on in tests:
+//
+//	tracer := vippstest.NewTracer()
+//	client := ecom.NewClient(vipps.ClientConfig{HTTPClient: srv.Client(), BaseURL: srv.URL, Tracer: tracer})
+//
+//	client.GetPayment(ctx, orderID)
+//	span := tracer.Spans()[0] // "ecom.GetPayment"
+type Tracer struct {
+	mu    sync.Mutex
+	spans []*Span
+}
+
+// Span is a span recorded by a Tracer.
+type Span struct {
+	Name       string
+	Kind       vipps.SpanKind
+	Parent     *Span
+	Attributes map[string]interface{}
+	Errors     []error
+	Ended      bool
+
+	tracer *Tracer
+}
+
+type spanKey struct{}
+
+// NewTracer returns a new Tracer.
+func NewTracer() *Tracer {
+	return &Tracer{}
+}
+
+// Start satisfies vipps.Tracer.
+func (t *Tracer) Start(ctx context.Context, name string, kind vipps.SpanKind, attrs ...vipps.Attribute) (context.Context, vipps.Span) {
+	parent, _ := ctx.Value(spanKey{}).(*Span)
+	s := &Span{
+		Name:       name,
+		Kind:       kind,
+		Parent:     parent,
+		Attributes: make(map[string]interface{}),
+		tracer:     t,
+	}
+	s.SetAttributes(attrs...)
+
+	t.mu.Lock()
+	t.spans = append(t.spans, s)
+	t.mu.Unlock()
+
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// Spans returns the spans started so far, in the order they were started.
+func (t *Tracer) Spans() []*Span {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return append([]*Span(nil), t.spans...)
+}
+
+// Reset forgets all spans started so far.
+func (t *Tracer) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.spans = nil
+}
+
+// SetAttributes satisfies vipps.Span.
+func (s *Span) SetAttributes(attrs ...vipps.Attribute) {
+	s.tracer.mu.Lock()
+	defer s.tracer.mu.Unlock()
+
+	for _, a := range attrs {
+		s.Attributes[a.Key] = a.Value
+	}
+}
+
+// RecordError satisfies vipps.Span.
+func (s *Span) RecordError(err error) {
+	s.tracer.mu.Lock()
+	defer s.tracer.mu.Unlock()
+
+	s.Errors = append(s.Errors, err)
+}
+
+// End satisfies vipps.Span.
+func (s *Span) End() {
+	s.tracer.mu.Lock()
+	defer s.tracer.mu.Unlock()
+
+	s.Ended = true
+}
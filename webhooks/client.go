@@ -0,0 +1,186 @@
+package webhooks
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-kit/kit/log"
+	"github.com/torfjor/go-vipps"
+	"github.com/torfjor/go-vipps/auth"
+	"github.com/torfjor/go-vipps/internal"
+	"net/http"
+	"net/url"
+)
+
+type Doer interface {
+	Do(req *http.Request, v interface{}) error
+	NewRequest(ctx context.Context, method, endpoint string, body interface{}) (*http.Request, error)
+}
+
+// Client represents an API client for the Vipps Webhooks v1 API.
+type Client struct {
+	BaseURL   string
+	APIClient Doer
+	// SkipValidation disables the validation of commands before they are
+	// sent.
+	SkipValidation bool
+	// Tracer, if set, traces every call on the Client.
+	Tracer vipps.Tracer
+	// MerchantSerialNumber is used for commands that have none, unless the
+	// context of the call carries one, see vipps.ContextWithMerchant.
+	MerchantSerialNumber string
+}
+
+// NewClient returns a configured Client. It panics if config has no
+// HTTPClient, or an unknown Environment and no BaseURL. An empty Environment
+// means production. Use New to get an error instead.
+func NewClient(config vipps.ClientConfig) *Client {
+	if config.HTTPClient == nil {
+		panic("config.HTTPClient cannot be nil")
+	}
+	c, err := newClient(config)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// New returns a Client configured with opts, or an error if the configuration
+// is invalid. Unless it is given a HTTPClient, the Client authenticates with
+// the Credentials, see auth.NewFromConfig.
+func New(opts ...vipps.Option) (*Client, error) {
+	config, err := vipps.NewConfig(opts...)
+	if err != nil {
+		return nil, err
+	}
+	if config.HTTPClient == nil {
+		if config.HTTPClient, err = auth.NewFromConfig(config); err != nil {
+			return nil, err
+		}
+	}
+	return newClient(config)
+}
+
+func newClient(config vipps.ClientConfig) (*Client, error) {
+	var logger log.Logger
+
+	baseUrl, err := config.APIBaseURL()
+	if err != nil {
+		return nil, err
+	}
+
+	if config.Logger == nil {
+		logger = log.NewNopLogger()
+	} else {
+		logger = config.Logger
+	}
+
+	return &Client{
+		BaseURL: baseUrl,
+		APIClient: &internal.APIClient{
+			L: logger,
+			C: config.Doer(),
+			R: (*internal.RetryPolicy)(config.RetryPolicy),
+			H: config.Headers(),
+		},
+		SkipValidation:       config.SkipValidation,
+		Tracer:               config.Tracer,
+		MerchantSerialNumber: config.MerchantSerialNumber,
+	}, nil
+}
+
+// RegisterWebhook registers a webhook for a sales unit. The secret in the
+// returned Registration is needed to verify the webhook's requests, and can
+// not be retrieved later.
+func (c *Client) RegisterWebhook(ctx context.Context, cmd RegisterWebhookCommand) (_ *Registration, err error) {
+	ctx, span := vipps.StartSpan(ctx, c.Tracer, vipps.SpanKindClient, "webhooks.RegisterWebhook")
+	defer func() { vipps.EndSpan(span, err) }()
+
+	if err := c.validate(cmd); err != nil {
+		return nil, err
+	}
+	endpoint := fmt.Sprintf("%s/%s", c.BaseURL, webhooksEndpoint)
+	method := http.MethodPost
+	res := Registration{}
+
+	req, err := c.APIClient.NewRequest(ctx, method, endpoint, cmd)
+	if err != nil {
+		return nil, err
+	}
+	internal.SetMerchant(req, c.merchant(ctx, cmd.MerchantSerialNumber))
+
+	err = c.APIClient.Do(req, &res)
+	if err != nil {
+		return nil, wrapErr(err)
+	}
+
+	return &res, nil
+}
+
+// ListWebhooks lists the webhooks registered for a sales unit.
+func (c *Client) ListWebhooks(ctx context.Context, merchantSerialNumber string) (_ []*Webhook, err error) {
+	ctx, span := vipps.StartSpan(ctx, c.Tracer, vipps.SpanKindClient, "webhooks.ListWebhooks")
+	defer func() { vipps.EndSpan(span, err) }()
+
+	endpoint := fmt.Sprintf("%s/%s", c.BaseURL, webhooksEndpoint)
+	method := http.MethodGet
+	res := struct {
+		Webhooks []*Webhook `json:"webhooks"`
+	}{}
+
+	req, err := c.APIClient.NewRequest(ctx, method, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	internal.SetMerchant(req, c.merchant(ctx, merchantSerialNumber))
+
+	err = c.APIClient.Do(req, &res)
+	if err != nil {
+		return nil, wrapErr(err)
+	}
+
+	return res.Webhooks, nil
+}
+
+// DeleteWebhook deletes a registered webhook.
+func (c *Client) DeleteWebhook(ctx context.Context, cmd DeleteWebhookCommand) (err error) {
+	ctx, span := vipps.StartSpan(ctx, c.Tracer, vipps.SpanKindClient, "webhooks.DeleteWebhook")
+	defer func() { vipps.EndSpan(span, err) }()
+
+	if err := c.validate(cmd); err != nil {
+		return err
+	}
+	endpoint := fmt.Sprintf("%s/%s/%s", c.BaseURL, webhooksEndpoint, url.PathEscape(cmd.ID))
+	method := http.MethodDelete
+
+	req, err := c.APIClient.NewRequest(ctx, method, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	internal.SetMerchant(req, c.merchant(ctx, cmd.MerchantSerialNumber))
+
+	err = c.APIClient.Do(req, nil)
+	if err != nil {
+		return wrapErr(err)
+	}
+
+	return nil
+}
+
+// merchant returns msn, or else the serial number carried by ctx or
+// configured for c.
+func (c *Client) merchant(ctx context.Context, msn string) string {
+	return internal.ResolveMerchant(ctx, msn, c.MerchantSerialNumber)
+}
+
+// validator is implemented by commands that can be validated before they are
+// sent.
+type validator interface {
+	Validate() error
+}
+
+func (c *Client) validate(cmd validator) error {
+	if c.SkipValidation {
+		return nil
+	}
+	return cmd.Validate()
+}
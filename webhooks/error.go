@@ -0,0 +1,30 @@
+package webhooks
+
+import (
+	"github.com/torfjor/go-vipps"
+	"github.com/torfjor/go-vipps/internal"
+)
+
+// ErrWebhooks represents an error returned from the Vipps Webhooks API, in
+// the problem details format of RFC 7807.
+type ErrWebhooks struct {
+	internal.Problem
+}
+
+// FieldError represents a problem with a single field of a request.
+type FieldError = internal.ProblemField
+
+func wrapErr(err error) error {
+	if err, ok := err.(internal.HTTPError); ok {
+		problem, ok := internal.ParseProblem(err.Body)
+		if !ok {
+			return vipps.NewAPIError(err.Status, err.RequestID, nil, vipps.ErrUnexpectedResponse{
+				Body:      err.Body,
+				Status:    err.Status,
+				HTTPError: err,
+			})
+		}
+		return vipps.NewAPIError(err.Status, err.RequestID, nil, ErrWebhooks{problem})
+	}
+	return err
+}
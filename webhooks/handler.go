@@ -0,0 +1,201 @@
+package webhooks
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"github.com/go-kit/kit/log"
+	"github.com/torfjor/go-vipps"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultWindow is the default for how far the date of a request may be
+	// from the current time.
+	DefaultWindow = 5 * time.Minute
+
+	maxBodySize   = 1 << 20
+	signedHeaders = "x-ms-date;host;x-ms-content-sha256"
+	authScheme    = "HMAC-SHA256 "
+)
+
+// Errors returned by Verifier.Verify.
+var (
+	ErrMissingSignature = errors.New("webhooks: missing signature headers")
+	ErrContentMismatch  = errors.New("webhooks: content hash does not match body")
+	ErrInvalidSignature = errors.New("webhooks: invalid signature")
+	ErrStaleRequest     = errors.New("webhooks: request date outside allowed window")
+)
+
+// Verifier verifies the HMAC-SHA256 signatures of webhook requests from
+// Vipps.
+type Verifier struct {
+	// Secret is the secret returned when the webhook was registered.
+	Secret string
+	// Window is how far the `X-Ms-Date` of a request may be from the current
+	// time. Requests outside the window are rejected as replays. Defaults to
+	// DefaultWindow.
+	Window time.Duration
+	// Now returns the current time. Defaults to time.Now.
+	Now func() time.Time
+}
+
+// Verify checks that body is the body of r, and that r is signed with the
+// Verifier's secret within the allowed window.
+func (v Verifier) Verify(r *http.Request, body []byte) error {
+	date := r.Header.Get("X-Ms-Date")
+	contentHash := r.Header.Get("X-Ms-Content-Sha256")
+	auth := r.Header.Get("Authorization")
+	if date == "" || contentHash == "" || !strings.HasPrefix(auth, authScheme) {
+		return ErrMissingSignature
+	}
+
+	sum := sha256.Sum256(body)
+	if !hmac.Equal([]byte(contentHash), []byte(base64.StdEncoding.EncodeToString(sum[:]))) {
+		return ErrContentMismatch
+	}
+
+	var headers, signature string
+	for _, param := range strings.Split(strings.TrimPrefix(auth, authScheme), "&") {
+		kv := strings.SplitN(param, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch kv[0] {
+		case "SignedHeaders":
+			headers = kv[1]
+		case "Signature":
+			signature = kv[1]
+		}
+	}
+	if headers != signedHeaders || signature == "" {
+		return ErrMissingSignature
+	}
+	expected := sign(v.Secret, r.Method, r.URL.RequestURI(), date, r.Host, contentHash)
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+		return ErrInvalidSignature
+	}
+
+	t, err := http.ParseTime(date)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	now, window := time.Now, v.Window
+	if v.Now != nil {
+		now = v.Now
+	}
+	if window <= 0 {
+		window = DefaultWindow
+	}
+	if d := now().Sub(t); d > window || d < -window {
+		return ErrStaleRequest
+	}
+
+	return nil
+}
+
+// Sign adds the headers that Vipps uses to sign webhook requests to r, as of
+// time now. It is useful to test handlers with signed requests.
+func Sign(r *http.Request, body []byte, secret string, now time.Time) {
+	sum := sha256.Sum256(body)
+	contentHash := base64.StdEncoding.EncodeToString(sum[:])
+	date := now.UTC().Format(http.TimeFormat)
+	host := r.Host
+	if host == "" {
+		host = r.URL.Host
+	}
+
+	r.Header.Set("X-Ms-Date", date)
+	r.Header.Set("X-Ms-Content-Sha256", contentHash)
+	r.Header.Set("Authorization", authScheme+"SignedHeaders="+signedHeaders+
+		"&Signature="+sign(secret, r.Method, r.URL.RequestURI(), date, host, contentHash))
+}
+
+func sign(secret, method, pathAndQuery, date, host, contentHash string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(method + "\n" + pathAndQuery + "\n" + date + ";" + host + ";" + contentHash))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// HandlerOption configures HandleEvents.
+type HandlerOption func(*handlerConfig)
+
+type handlerConfig struct {
+	logger log.Logger
+	tracer vipps.Tracer
+}
+
+// WithLogger makes HandleEvents log rejected requests and failed callbacks to
+// logger, e.g. the Logger of a vipps.ClientConfig.
+func WithLogger(logger log.Logger) HandlerOption {
+	return func(c *handlerConfig) {
+		c.logger = logger
+	}
+}
+
+// WithTracer makes HandleEvents start a server span with tracer for every
+// event, as a child of the span in the request context, if any. The callback
+// is called with a context carrying the span.
+func WithTracer(tracer vipps.Tracer) HandlerOption {
+	return func(c *handlerConfig) {
+		c.tracer = tracer
+	}
+}
+
+// HandleEvents returns a convenience http.HandlerFunc for receiving webhook
+// events from Vipps.
+//
+// Requests that are not signed with the secret of v, or are dated outside its
+// window, are rejected with `401 Unauthorized`. `cb` is called with the
+// request context and the decoded Event. If it returns an error, the request
+// fails with `500 Internal Server Error` and Vipps will retry the delivery.
+// The error is logged and recorded on the span of the callback, but not sent
+// in the response.
+func HandleEvents(v Verifier, cb func(ctx context.Context, e Event) error, opts ...HandlerOption) http.HandlerFunc {
+	c := &handlerConfig{
+		logger: log.NewNopLogger(),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", "POST")
+			http.Error(w, "Unsupported method", http.StatusMethodNotAllowed)
+			return
+		}
+		defer r.Body.Close()
+		body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := v.Verify(r, body); err != nil {
+			c.logger.Log("msg", "rejected unauthorized webhook", "method", r.Method, "url", r.URL, "remote_addr", r.RemoteAddr, "err", err)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var e Event
+		if err := json.Unmarshal(body, &e); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		ctx, span := vipps.StartSpan(r.Context(), c.tracer, vipps.SpanKindServer, "webhooks.HandleEvents", vipps.ReferenceAttr(e.Reference))
+		err = cb(ctx, e)
+		vipps.EndSpan(span, err)
+		if err != nil {
+			c.logger.Log("msg", "callback failed", "method", r.Method, "url", r.URL, "reference", e.Reference, "err", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+	}
+	return fn
+}
@@ -0,0 +1,190 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-kit/kit/log"
+	"github.com/torfjor/go-vipps"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	secret = "secret"
+	body   = `{"msn":"123456","reference":"order-1","name":"AUTHORIZED","amount":{"currency":"NOK","value":1000},"success":true}`
+)
+
+func TestVerify(t *testing.T) {
+	now := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		secret  string
+		signed  time.Time
+		mutate  func(r *http.Request) []byte
+		wantErr error
+	}{
+		{
+			name:   "valid",
+			secret: secret,
+			signed: now,
+		},
+		{
+			name:   "within window",
+			secret: secret,
+			signed: now.Add(-4 * time.Minute),
+		},
+		{
+			name:    "wrong secret",
+			secret:  "other",
+			signed:  now,
+			wantErr: ErrInvalidSignature,
+		},
+		{
+			name:    "stale",
+			secret:  secret,
+			signed:  now.Add(-6 * time.Minute),
+			wantErr: ErrStaleRequest,
+		},
+		{
+			name:    "from the future",
+			secret:  secret,
+			signed:  now.Add(6 * time.Minute),
+			wantErr: ErrStaleRequest,
+		},
+		{
+			name:   "tampered body",
+			secret: secret,
+			signed: now,
+			mutate: func(r *http.Request) []byte {
+				return []byte(strings.Replace(body, "1000", "100000", 1))
+			},
+			wantErr: ErrContentMismatch,
+		},
+		{
+			name:   "tampered path",
+			secret: secret,
+			signed: now,
+			mutate: func(r *http.Request) []byte {
+				r.URL.Path = "/other"
+				return nil
+			},
+			wantErr: ErrInvalidSignature,
+		},
+		{
+			name:   "tampered date",
+			secret: secret,
+			signed: now,
+			mutate: func(r *http.Request) []byte {
+				r.Header.Set("X-Ms-Date", now.Add(time.Second).Format(http.TimeFormat))
+				return nil
+			},
+			wantErr: ErrInvalidSignature,
+		},
+		{
+			name:   "missing signature",
+			secret: secret,
+			signed: now,
+			mutate: func(r *http.Request) []byte {
+				r.Header.Del("Authorization")
+				return nil
+			},
+			wantErr: ErrMissingSignature,
+		},
+		{
+			name:   "other signed headers",
+			secret: secret,
+			signed: now,
+			mutate: func(r *http.Request) []byte {
+				r.Header.Set("Authorization", strings.Replace(r.Header.Get("Authorization"), signedHeaders, "host", 1))
+				return nil
+			},
+			wantErr: ErrMissingSignature,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "https://example.com/webhooks?x=1", strings.NewReader(body))
+			Sign(r, []byte(body), tt.secret, tt.signed)
+			b := []byte(body)
+			if tt.mutate != nil {
+				if mutated := tt.mutate(r); mutated != nil {
+					b = mutated
+				}
+			}
+			v := Verifier{Secret: secret, Now: func() time.Time { return now }}
+			if err := v.Verify(r, b); err != tt.wantErr {
+				t.Errorf("Verify = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestHandleEvents(t *testing.T) {
+	v := Verifier{Secret: secret}
+	tests := []struct {
+		name       string
+		method     string
+		secret     string
+		cbErr      error
+		wantStatus int
+		wantEvent  bool
+	}{
+		{"delivered", http.MethodPost, secret, nil, http.StatusOK, true},
+		{"unsigned", http.MethodPost, "other", nil, http.StatusUnauthorized, false},
+		{"callback fails", http.MethodPost, secret, errors.New("failed"), http.StatusInternalServerError, true},
+		{"wrong method", http.MethodGet, secret, nil, http.StatusMethodNotAllowed, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got *Event
+			h := HandleEvents(v, func(ctx context.Context, e Event) error {
+				got = &e
+				return tt.cbErr
+			})
+			r := httptest.NewRequest(tt.method, "https://example.com/webhooks", strings.NewReader(body))
+			Sign(r, []byte(body), tt.secret, time.Now())
+			w := httptest.NewRecorder()
+			h(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if (got != nil) != tt.wantEvent {
+				t.Fatalf("event = %v, want delivered %v", got, tt.wantEvent)
+			}
+			if got != nil && (got.Reference != "order-1" || got.Amount != vipps.Ore(1000) || !got.Success) {
+				t.Errorf("event = %+v", got)
+			}
+		})
+	}
+}
+
+func TestHandleEventsHidesCallbackError(t *testing.T) {
+	var logged []interface{}
+	logger := log.LoggerFunc(func(keyvals ...interface{}) error {
+		logged = append(logged, keyvals...)
+		return nil
+	})
+	h := HandleEvents(Verifier{Secret: secret}, func(ctx context.Context, e Event) error {
+		return errors.New("database password expired")
+	}, WithLogger(logger))
+
+	r := httptest.NewRequest(http.MethodPost, "https://example.com/webhooks", strings.NewReader(body))
+	Sign(r, []byte(body), secret, time.Now())
+	w := httptest.NewRecorder()
+	h(w, r)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+	if strings.Contains(w.Body.String(), "database") {
+		t.Errorf("body = %q, leaks the callback error", w.Body.String())
+	}
+	if !strings.Contains(fmt.Sprint(logged...), "database password expired") {
+		t.Errorf("logged %v, want the callback error", logged)
+	}
+}
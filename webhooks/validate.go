@@ -0,0 +1,23 @@
+package webhooks
+
+import (
+	"github.com/torfjor/go-vipps"
+	"github.com/torfjor/go-vipps/internal"
+)
+
+// Validate checks cmd against the rules documented for the Webhooks API. It
+// returns a *vipps.ValidationError listing every invalid field.
+func (cmd RegisterWebhookCommand) Validate() error {
+	var e vipps.ValidationError
+	e.Check(internal.IsHTTPS(cmd.URL), "url", "must be an https URL")
+	e.Check(len(cmd.Events) > 0, "events", "is required")
+	return e.Err()
+}
+
+// Validate checks cmd against the rules documented for the Webhooks API. It
+// returns a *vipps.ValidationError listing every invalid field.
+func (cmd DeleteWebhookCommand) Validate() error {
+	var e vipps.ValidationError
+	e.Check(cmd.ID != "", "id", "is required")
+	return e.Err()
+}
@@ -0,0 +1,88 @@
+// Package webhooks provides a Client for the Vipps Webhooks API v1, and a
+// http.Handler that receives the signed webhook requests Vipps sends.
+//
+// Webhooks are registered per sales unit and event type. Every registration
+// gets its own secret, which Vipps uses to sign requests with HMAC-SHA256.
+// Unlike the static `authToken` of the ecom callbacks, the signature covers the
+// request body, path and date, so forged and replayed requests can be rejected.
+package webhooks
+
+import (
+	"encoding/json"
+	"github.com/torfjor/go-vipps"
+	"github.com/torfjor/go-vipps/epayment"
+	"github.com/torfjor/go-vipps/internal"
+	"time"
+)
+
+const webhooksEndpoint = "webhooks/v1/webhooks"
+
+// EventType is a type of event that a webhook can be registered for.
+type EventType string
+
+// List of values that EventType can take.
+const (
+	EventTypePaymentCreated    EventType = "epayments.payment.created.v1"
+	EventTypePaymentAborted    EventType = "epayments.payment.aborted.v1"
+	EventTypePaymentExpired    EventType = "epayments.payment.expired.v1"
+	EventTypePaymentCancelled  EventType = "epayments.payment.cancelled.v1"
+	EventTypePaymentCaptured   EventType = "epayments.payment.captured.v1"
+	EventTypePaymentRefunded   EventType = "epayments.payment.refunded.v1"
+	EventTypePaymentAuthorized EventType = "epayments.payment.authorized.v1"
+	EventTypePaymentTerminated EventType = "epayments.payment.terminated.v1"
+)
+
+// RegisterWebhookCommand represents the command used to register a webhook.
+type RegisterWebhookCommand struct {
+	MerchantSerialNumber string `json:"-"`
+	// URL is a publicly reachable HTTPS endpoint that will receive the
+	// events.
+	URL    string      `json:"url"`
+	Events []EventType `json:"events"`
+}
+
+// Registration represents a registered webhook and the secret used to sign
+// its requests.
+type Registration struct {
+	ID     string `json:"id"`
+	Secret string `json:"secret"`
+}
+
+// Webhook represents a registered webhook.
+type Webhook struct {
+	ID     string      `json:"id"`
+	URL    string      `json:"url"`
+	Events []EventType `json:"events"`
+}
+
+// DeleteWebhookCommand represents the command used to delete a webhook.
+type DeleteWebhookCommand struct {
+	MerchantSerialNumber string
+	ID                   string
+}
+
+// Event represents a payment event delivered to a webhook.
+type Event struct {
+	MerchantSerialNumber string             `json:"msn"`
+	Reference            string             `json:"reference"`
+	PSPReference         string             `json:"pspReference"`
+	Name                 epayment.EventName `json:"name"`
+	Amount               vipps.Money        `json:"amount"`
+	Timestamp            time.Time          `json:"timestamp"`
+	IdempotencyKey       string             `json:"idempotencyKey"`
+	Success              bool               `json:"success"`
+}
+
+// UnmarshalJSON satisfies json.Unmarshaler.
+func (e *Event) UnmarshalJSON(b []byte) error {
+	type alias Event
+	v := struct {
+		*alias
+		Amount internal.Amount `json:"amount"`
+	}{alias: (*alias)(e)}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	e.Amount = vipps.Money{Minor: v.Amount.Value, Currency: vipps.Currency(v.Amount.Currency)}
+	return nil
+}